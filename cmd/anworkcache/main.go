@@ -0,0 +1,178 @@
+// This is a command line tool for managing the cache that anwork releases are unpacked into, and the
+// context directories that tests leave behind.
+//
+//	$ anworkcache list
+//	$ anworkcache prune -age 720h -size 500M
+//	$ anworkcache contexts -age 1h
+//	$ anworkcache contexts -age 1h -root . -subdirs
+//	$ anworkcache verify
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ankeesler/anwork_testing/core"
+)
+
+func main() {
+	flags := flag.NewFlagSet("anworkcache", flag.ExitOnError)
+	cacheDir := flags.String("cache", "", "The cache directory (default is the anwork_testing cache)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: anworkcache [-cache dir] list|prune|contexts|verify [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "list      List the cached releases with their size and last use")
+		fmt.Fprintln(os.Stderr, "prune     Remove cached releases by age and/or size budget")
+		fmt.Fprintln(os.Stderr, "contexts  Remove context directories that tests left behind")
+		fmt.Fprintln(os.Stderr, "verify    Verify the cached releases against their archives")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if *cacheDir == "" {
+		var err error
+		if *cacheDir, err = core.CacheDir(); err != nil {
+			fail(err)
+		}
+	}
+
+	var err error
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "list":
+		err = list(*cacheDir)
+	case "prune":
+		err = prune(*cacheDir, args)
+	case "contexts":
+		err = contexts(args)
+	case "verify":
+		err = verify(*cacheDir)
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "anworkcache: error:", err)
+	os.Exit(1)
+}
+
+func list(cacheDir string) error {
+	entries, err := core.ListCache(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	fmt.Println("NAME\tSIZE\tLAST USED\tSOURCE")
+	for _, entry := range entries {
+		fmt.Println(entry.String())
+		totalSize += entry.Size
+	}
+	fmt.Printf("%d entries, %d bytes in %s\n", len(entries), totalSize, cacheDir)
+
+	return nil
+}
+
+func prune(cacheDir string, args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	maxAge := flags.Duration("age", 0, "Remove entries that have not been used within this duration")
+	maxSize := flags.String("size", "", "Remove the least recently used entries until the cache is this big (e.g., 500M)")
+	flags.Parse(args)
+
+	if *maxAge == 0 && *maxSize == "" {
+		return errors.New("prune needs -age and/or -size")
+	}
+
+	size, err := parseSize(*maxSize)
+	if err != nil {
+		return err
+	}
+
+	removed, err := core.PruneCache(cacheDir, *maxAge, size)
+	for _, entry := range removed {
+		fmt.Println("removed", entry.String())
+	}
+	return err
+}
+
+func contexts(args []string) error {
+	flags := flag.NewFlagSet("contexts", flag.ExitOnError)
+	root := flags.String("root", core.ContextRoot(), "The directory that context directories are created in")
+	maxAge := flags.Duration("age", time.Hour, "Only remove context directories older than this")
+	subdirs := flags.Bool("subdirs", false, "Also look in the directories in the root (e.g., test package directories)")
+	flags.Parse(args)
+
+	removed, err := core.RemoveOrphanedContexts(*root, *maxAge, *subdirs)
+	for _, path := range removed {
+		fmt.Println("removed", path)
+	}
+	return err
+}
+
+func verify(cacheDir string) error {
+	entries, err := core.ListCache(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, entry := range entries {
+		if entry.ArchivePath == "" && entry.Complete {
+			continue // local builds have nothing to be verified against
+		}
+		if err := core.VerifyCacheEntry(entry); err != nil {
+			fmt.Println("FAIL", err)
+			failures++
+		} else {
+			fmt.Println("OK  ", entry.Name, entry.ArchivePath)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d cache entries failed verification", failures)
+	}
+	return nil
+}
+
+// Parse a size like 1024, 100K, 500M, or 2G into a number of bytes. An empty size is 0.
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(size[len(size)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+
+	number, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size %s: %s", size, err)
+	}
+	return number * multiplier, nil
+}
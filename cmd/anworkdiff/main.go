@@ -0,0 +1,73 @@
+// This is a command line tool that prints what changed between two anwork context files (see
+// anworkcontext.Diff). A context directory can be passed instead of a context file, in which case its
+// default context is used. Like diff, it exits with status 0 if the contexts are the same, 1 if they
+// are different, and 2 if something went wrong.
+//
+//	$ anworkdiff v2/data/default-context /tmp/anwork_testing/anwork-TestFoo-123/default-context
+//	$ anworkdiff -q before/ after/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
+)
+
+func main() {
+	flags := flag.NewFlagSet("anworkdiff", flag.ExitOnError)
+	quiet := flags.Bool("q", false, "Only report whether the contexts are different")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: anworkdiff [-q] before after")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Print the tasks and journal entries that changed between two contexts.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	before, err := readContext(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "anworkdiff: error:", err)
+		os.Exit(2)
+	}
+	after, err := readContext(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "anworkdiff: error:", err)
+		os.Exit(2)
+	}
+
+	delta := anworkcontext.Diff(before, after)
+	if delta.Empty() {
+		return
+	}
+	if *quiet {
+		fmt.Printf("Contexts %s and %s differ\n", flags.Arg(0), flags.Arg(1))
+	} else {
+		fmt.Println(delta)
+	}
+	os.Exit(1)
+}
+
+// Read the context at the provided path, which is either a context file or a context directory.
+// Unlike anwork, a context that does not exist is an error, since it is probably a typo.
+func readContext(path string) (*anworkcontext.State, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "default-context")
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	return anworkcontext.ReadFile(path)
+}
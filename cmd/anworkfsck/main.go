@@ -0,0 +1,77 @@
+// This is a command line tool that checks anwork context files for corruption (see
+// anworkcontext.State.Validate). A context directory can be passed instead of a context file, in which
+// case every context file in it is checked.
+//
+//	$ anworkfsck v2/data/default-context
+//	$ anworkfsck /tmp/anwork_testing/anwork-TestFoo-123
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
+)
+
+func main() {
+	flags := flag.NewFlagSet("anworkfsck", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: anworkfsck context...")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Check that each context file (or each context file in a context directory) is valid.")
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	failures := 0
+	for _, arg := range flags.Args() {
+		paths, err := contextFiles(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "anworkfsck: error:", err)
+			failures++
+			continue
+		}
+		for _, path := range paths {
+			if err := anworkcontext.ValidateFile(path); err != nil {
+				fmt.Printf("%s: %s\n", path, err)
+				failures++
+			} else {
+				fmt.Println("OK", path)
+			}
+		}
+	}
+
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// Returns the context files at the provided path, which is either a context file or a context
+// directory.
+func contextFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			paths = append(paths, filepath.Join(path, info.Name()))
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,105 @@
+// This is a command line tool that converts anwork context files to JSON and back (see
+// anworkcontext.State), so that a context can be read in a code review, edited by hand, or attached
+// to a bug report. Every field is kept, including the ones that anworkcontext does not know about, so
+// exporting a context and importing it again gives back the same bytes.
+//
+//	$ anworkjson export v2/data/default-context
+//	$ anworkjson export v2/data/default-context default-context.json
+//	$ anworkjson import default-context.json v2/data/default-context
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: anworkjson export context [json]")
+	fmt.Fprintln(os.Stderr, "       anworkjson import json context")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "export  Write the context as JSON to the json file (or stdout)")
+	fmt.Fprintln(os.Stderr, "import  Write the JSON in the json file (or stdin, if it is -) to the context file")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch args := os.Args[2:]; {
+	case os.Args[1] == "export" && (len(args) == 1 || len(args) == 2):
+		output := ""
+		if len(args) == 2 {
+			output = args[1]
+		}
+		err = export(args[0], output)
+	case os.Args[1] == "import" && len(args) == 2:
+		err = importJSON(args[0], args[1])
+	default:
+		usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "anworkjson: error:", err)
+		os.Exit(1)
+	}
+}
+
+func export(contextPath, output string) error {
+	data, err := ioutil.ReadFile(contextPath)
+	if err != nil {
+		return err
+	}
+	state, err := anworkcontext.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents = append(contents, '\n')
+
+	if output == "" {
+		_, err = os.Stdout.Write(contents)
+		return err
+	}
+	return ioutil.WriteFile(output, contents, 0644)
+}
+
+func importJSON(input, contextPath string) error {
+	var contents []byte
+	var err error
+	if input == "-" {
+		contents, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		contents, err = ioutil.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Catch typos in hand edited JSON, instead of silently dropping the misspelled field.
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	state := &anworkcontext.State{}
+	if err := decoder.Decode(state); err != nil {
+		return fmt.Errorf("Cannot parse %s: %s", input, err)
+	}
+
+	// A hand edited context might be invalid on purpose (e.g., to test a corner case), so this is
+	// only a warning.
+	if err := state.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "anworkjson: warning:", err)
+	}
+	return anworkcontext.WriteFile(contextPath, state)
+}
@@ -0,0 +1,96 @@
+// This is a command line tool for generating and checking the MANIFEST files that live next to the
+// release archives (see core.Manifest). It is run by rollup.sh whenever a new release is added.
+//
+//	$ anworkmanifest release/v2/anwork-2.zip
+//	$ anworkmanifest -check release/v*/anwork-*.zip
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ankeesler/anwork_testing/core"
+)
+
+func main() {
+	flags := flag.NewFlagSet("anworkmanifest", flag.ExitOnError)
+	check := flags.Bool("check", false, "Check the archives against their manifests instead of writing them")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: anworkmanifest [-check] archive...")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Write (or check) the MANIFEST file next to each release archive.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	failures := 0
+	for _, archivePath := range flags.Args() {
+		var err error
+		if *check {
+			err = checkManifest(archivePath)
+		} else {
+			err = writeManifest(archivePath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "anworkmanifest: error:", err)
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+func manifestPath(archivePath string) string {
+	return filepath.Join(filepath.Dir(archivePath), core.ManifestName)
+}
+
+func writeManifest(archivePath string) error {
+	manifest, err := core.MakeManifest(archivePath)
+	if err != nil {
+		return err
+	}
+
+	path := manifestPath(archivePath)
+	if err := manifest.WriteFile(path); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s (%d files)\n", path, len(manifest.Files))
+	return nil
+}
+
+func checkManifest(archivePath string) error {
+	manifest, err := core.ReadManifest(manifestPath(archivePath))
+	if err != nil {
+		return err
+	}
+	if err := manifest.VerifyArchive(archivePath); err != nil {
+		return err
+	}
+
+	// Check the files inside of the archive too, in case the manifest itself was edited by hand.
+	actual, err := core.MakeManifest(archivePath)
+	if err != nil {
+		return err
+	}
+	for name, hash := range manifest.Files {
+		if actual.Files[name] != hash {
+			return fmt.Errorf("%s in %s does not match its manifest", name, archivePath)
+		}
+	}
+	if len(actual.Files) != len(manifest.Files) {
+		return fmt.Errorf("%s has %d files, but its manifest has %d", archivePath, len(actual.Files), len(manifest.Files))
+	}
+
+	fmt.Println("OK", archivePath)
+	return nil
+}
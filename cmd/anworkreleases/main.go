@@ -0,0 +1,57 @@
+// This is a command line tool that lists the anwork releases that the tests can use (see
+// core.Releases).
+//
+//	$ anworkreleases
+//	$ anworkreleases -latest
+//	$ anworkreleases -has 2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ankeesler/anwork_testing/core"
+)
+
+func main() {
+	flags := flag.NewFlagSet("anworkreleases", flag.ExitOnError)
+	latest := flags.Bool("latest", false, "Only print the latest version")
+	var has core.Version
+	flags.Var(&has, "has", "Exit with a non-zero status if this version is not available")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: anworkreleases [-latest] [-has X]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "List the anwork releases in the release directory (or %s).\n", core.ReleaseEnv)
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	releases, err := core.Releases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "anworkreleases: error:", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case !has.IsZero():
+		if releases.Get(has) == nil {
+			fmt.Fprintf(os.Stderr, "anworkreleases: version %s is not available (have %v)\n", has, releases.Versions())
+			os.Exit(1)
+		}
+	case *latest:
+		if release := releases.Latest(); release != nil {
+			fmt.Println(release.Version)
+		}
+	default:
+		for _, release := range releases {
+			fmt.Printf("%s\t%s\t%d\t%s\t%s\n", release.Version, release.ArchivePath, release.Size,
+				release.Hash, strings.Join(release.Platforms, ","))
+			for _, doc := range release.Docs {
+				fmt.Printf("\t%s\n", doc)
+			}
+		}
+	}
+}
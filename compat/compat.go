@@ -0,0 +1,34 @@
+// This package contains the compatibility corpus, i.e., the contexts that each anwork release writes
+// for a few scripted scenarios (see generate.go), and TestCompatibility, which opens every one of
+// them with every newer release.
+package compat
+
+import "github.com/ankeesler/anwork_testing/core"
+
+// ExcludedRelease is a release that has no contexts in the compatibility corpus.
+type ExcludedRelease struct {
+	Version core.Version
+	// This says why the release is left out of the corpus.
+	Reason string
+}
+
+// These are the releases that are left out of the compatibility corpus. Every other release must
+// have a data/v<version> directory.
+var ExcludedReleases = []ExcludedRelease{
+	{
+		Version: core.MajorVersion(1),
+		Reason: "anwork 1 has a different CLI (e.g., \"task create\" instead of \"create\"), so the " +
+			"scenarios cannot be run with it, and it needs Java to run at all",
+	},
+}
+
+// Returns the reason that the provided release is left out of the compatibility corpus, or false if
+// it is not.
+func IsExcluded(version core.Version) (string, bool) {
+	for _, excluded := range ExcludedReleases {
+		if excluded.Version.Equal(version) {
+			return excluded.Reason, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+package compat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ankeesler/anwork_testing/core"
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
+)
+
+//go:generate go run generate.go -o data
+
+// Every context in the corpus (data/v<version>/<scenario>) is opened with every release that is at
+// least as new as the one that wrote it. The newer release has to read all of the tasks and journal
+// entries, and it has to keep all of them when it writes the context back out.
+func TestCompatibility(t *testing.T) {
+	t.Parallel()
+
+	releases, err := core.Releases()
+	if err != nil {
+		t.Fatal("Cannot list releases:", err)
+	}
+
+	// A release that is missing from the corpus would never be checked, so make sure that every
+	// release that is not excluded on purpose is there.
+	for _, release := range releases {
+		if _, excluded := IsExcluded(release.Version); excluded {
+			continue
+		}
+		dataDir := filepath.Join("data", "v"+release.Version.String())
+		if infos, err := ioutil.ReadDir(dataDir); err != nil || len(infos) == 0 {
+			t.Errorf("There are no contexts for anwork %s in %s; run go generate", release.Version, dataDir)
+		}
+	}
+
+	contexts, err := filepath.Glob(filepath.Join("data", "v*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) == 0 {
+		t.Fatal("There are no contexts in the corpus; run go generate")
+	}
+
+	for _, context := range contexts {
+		context := context
+		writer, err := core.ParseVersion(strings.TrimPrefix(filepath.Base(filepath.Dir(context)), "v"))
+		if err != nil {
+			t.Errorf("Cannot tell which release wrote %s: %s", context, err)
+			continue
+		}
+
+		expected, err := anworkcontext.ReadFile(context)
+		if err != nil {
+			t.Errorf("Cannot decode %s: %s", context, err)
+			continue
+		}
+
+		for _, release := range releases.Range(writer, releases.Latest().Version) {
+			reader := release.Version
+			name := fmt.Sprintf("v%s/%s/v%s", writer, filepath.Base(context), reader)
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				checkContext(t, reader, context, expected)
+			})
+		}
+	}
+}
+
+// Check that the provided version of anwork can read and write the provided context, which should
+// decode to the provided state.
+func checkContext(t *testing.T, version core.Version, context string, expected *anworkcontext.State) {
+	anwork := core.MustMakeAnwork(t, version, core.WithFixture(context))
+
+	for _, task := range expected.Tasks {
+		output, err := anwork.Run("show", task.Name)
+		if err != nil {
+			t.Errorf("Cannot show task %s: %s", task.Name, err)
+			continue
+		}
+		for _, line := range []string{
+			fmt.Sprintf("Name: %s", task.Name),
+			fmt.Sprintf("ID: %d", task.ID),
+			fmt.Sprintf("Priority: %d", task.Priority),
+			fmt.Sprintf("State: %s", task.State),
+		} {
+			if !strings.Contains(output, line) {
+				t.Errorf("Expected task %s to have '%s', got:\n%s", task.Name, line, output)
+			}
+		}
+	}
+
+	output, err := anwork.Run("journal")
+	if err != nil {
+		t.Fatal("Cannot show journal:", err)
+	}
+	// The journal is printed newest entry first, one "[<date>]: <title>" line per entry.
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if output == "" {
+		lines = []string{}
+	}
+	if len(lines) != len(expected.Journal) {
+		t.Errorf("Expected %d journal entries, got:\n%s", len(expected.Journal), output)
+	} else {
+		for i, entry := range expected.Journal {
+			line := lines[len(lines)-1-i]
+			if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]: "+entry.Title) {
+				t.Errorf("Expected journal entry %d to be '%s', got '%s'", i, entry.Title, line)
+			}
+		}
+	}
+
+	// Make the release write the context back out. Nothing but the new task should change.
+	_, delta, err := anwork.ExecuteDelta("create", "compat-task")
+	if err != nil {
+		t.Fatal("Cannot create task:", err)
+	}
+	if len(delta.Added) != 1 || delta.Added[0].Name != "compat-task" || len(delta.Removed) != 0 ||
+		len(delta.Modified) != 0 || len(delta.NewEntries) != 1 || len(delta.RemovedEntries) != 0 {
+		t.Errorf("Expected creating a task to only add that task, got:\n%s", delta)
+	}
+}
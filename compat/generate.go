@@ -0,0 +1,153 @@
+//go:build ignore
+
+// This program adds the contexts that each anwork release writes for the scenarios below to the
+// compatibility corpus in the data directory, i.e., data/v<version>/<scenario>. Contexts that are
+// already in the corpus are left alone, because they are the contexts that users of that release
+// really have on disk. Releases in compat.ExcludedReleases are skipped (and asking for one is an
+// error). It fails if any other release cannot be run on this machine (see
+// core.ErrPrerequisiteMissing), since the corpus would silently be missing that release. It is run
+// by "go generate" in this directory, and by rollup.sh for a new release.
+//
+//	$ go run generate.go -o data
+//	$ go run generate.go -o data -v 3
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ankeesler/anwork_testing/compat"
+	"github.com/ankeesler/anwork_testing/core"
+)
+
+// These are the commands that make up each scenario, by name.
+var scenarios = map[string][][]string{
+	"tasks": {
+		{"create", "task-a"},
+		{"create", "task-b"},
+		{"create", "task-c"},
+	},
+	"states": {
+		{"create", "task-a"},
+		{"create", "task-b"},
+		{"create", "task-c"},
+		{"create", "task-d"},
+		{"set-running", "task-a"},
+		{"set-blocked", "task-b"},
+		{"set-running", "task-c"},
+		{"set-finished", "task-c"},
+	},
+	"priorities": {
+		{"create", "task-a"},
+		{"create", "task-b"},
+		{"set-priority", "task-a", "1"},
+		{"set-priority", "task-b", "20"},
+		{"set-priority", "task-a", "-5"},
+	},
+	"notes": {
+		{"create", "task-a"},
+		{"note", "task-a", "This is a note"},
+		{"note", "task-a", "This is a note with unicode: naïve ✓"},
+	},
+	"deletes": {
+		{"create", "task-a"},
+		{"create", "task-b"},
+		{"delete", "task-a"},
+		{"create", "task-c"},
+		{"set-blocked", "task-c"},
+	},
+}
+
+func main() {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	dir := flags.String("o", ".", "The corpus directory")
+	var version core.Version
+	flags.Var(&version, "v", "Only add contexts for this release")
+	flags.Parse(os.Args[1:])
+
+	releases, err := core.Releases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	found := false
+	for _, release := range releases {
+		if !version.IsZero() && !release.Version.Equal(version) {
+			continue
+		}
+		found = true
+		if reason, excluded := compat.IsExcluded(release.Version); excluded {
+			if !version.IsZero() {
+				fmt.Fprintf(os.Stderr, "error: anwork %s is excluded from the corpus: %s\n", release.Version, reason)
+				os.Exit(1)
+			}
+			fmt.Printf("skipping anwork %s: %s\n", release.Version, reason)
+			continue
+		}
+		for _, name := range names {
+			path := filepath.Join(*dir, "v"+release.Version.String(), name)
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+
+			var missing *core.ErrPrerequisiteMissing
+			if err := generate(release.Version, scenarios[name], path); errors.As(err, &missing) {
+				fmt.Fprintf(os.Stderr, "error: cannot run anwork %s on this machine: %s\n", release.Version, missing)
+				os.Exit(1)
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "error: anwork %s, scenario %s: %s\n", release.Version, name, err)
+				os.Exit(1)
+			}
+			fmt.Println("wrote", path)
+		}
+	}
+
+	if !found {
+		fmt.Fprintf(os.Stderr, "error: there is no anwork release %s\n", version)
+		os.Exit(1)
+	}
+}
+
+// Run the provided commands with the provided version of anwork, and then write the context that
+// it ends up with to the provided path.
+func generate(version core.Version, commands [][]string, path string) error {
+	contextDir, err := ioutil.TempDir("", "anwork-compat")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(contextDir)
+
+	anwork, err := core.MakeAnwork(version, core.WithContextDir(contextDir))
+	if err != nil {
+		return err
+	}
+	defer anwork.Close()
+
+	for _, command := range commands {
+		if _, err := anwork.Run(command...); err != nil {
+			return fmt.Errorf("'%s' failed: %s", strings.Join(command, " "), err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(contextDir, "default-context"))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
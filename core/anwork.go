@@ -1,27 +1,43 @@
 package core
 
 import (
-	"archive/zip"
-	"crypto/md5"
-	"crypto/rand"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"math"
-	"math/big"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
-	"sync"
+	"testing"
+	"time"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
 )
 
-// This is the path to where the Anwork release zip files are kept.
-const ReleasePath string = "../release"
+// This is the default amount of time that a single command is allowed to run on an Anwork instance
+// before it is killed. See Anwork.SetTimeout.
+const DefaultTimeout = time.Minute
+
+// This environment variable can hold the directory that context directories are created in. See
+// ContextRoot.
+const ContextRootEnv = "ANWORK_CONTEXT_ROOT"
+
+// If this environment variable is set (to anything), then the context directories of failed tests
+// are kept by default. See WithKeepOnFailure.
+const KeepContextEnv = "ANWORK_KEEP_CONTEXT"
+
+// If this environment variable is set (to anything), then the contexts of every Anwork instance are
+// validated after each command by default. See WithValidation.
+const ValidateEnv = "ANWORK_VALIDATE"
 
-// This is the lock that guards the unzipping procedure.
-var unzipMutex sync.Mutex
+// This is the name of the file in a context directory that anwork uses when no context name is
+// passed to it (via -c).
+const defaultContextName = "default-context"
 
 // Anwork represents an Anwork program that can be executed.
 type Anwork struct {
@@ -30,201 +46,420 @@ type Anwork struct {
 
 	// This is the path to the actual executable.
 	binaryPath string
+
+	// This is true if the context directory should be deleted when this Anwork instance is closed.
+	ownsContext bool
+
+	// This is the directory that context directories are created in (see WithContextRoot). If it is
+	// empty, then ContextRoot is used.
+	contextRoot string
+
+	// This is the amount of time that a single command is allowed to run. If it is 0, then commands
+	// are allowed to run forever.
+	timeout time.Duration
+
+	// These are extra environment variables that every command is run with.
+	env []string
+
+	// This is the directory that every command is run in. If it is empty, then commands are run in
+	// the current working directory.
+	workingDir string
+
+	// This is where commands and their results are logged. It can be nil.
+	logger Logger
+
+	// This is the test that this Anwork instance is cleaned up with (see WithCleanup). It can be nil.
+	tb testing.TB
+
+	// This is true if the context directory should be left in place when the test fails (see
+	// WithKeepOnFailure).
+	keepOnFailure bool
+
+	// This is true if the contexts should be validated after every command (see WithValidation).
+	validate bool
 }
 
-// Make an Anwork struct for the provided version. This function will look in the correct version
-// directory in the release path directory (see ReleasePath).
-func MakeAnwork(version int) (*Anwork, error) {
-	path := makeAnworkZipPath(version)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, err
+// Make an Anwork struct for the provided version. The anwork binary for the version comes from the
+// configured ReleaseSource (see RunTests and ReleaseEnv), or from a LocalBuild. The Anwork instance
+// can be configured with any number of Option's (see WithEnv, WithContextDir, etc.), including
+// WithBinary, which skips looking up the binary altogether.
+//
+// If the anwork binary needs something that is not installed on this machine (e.g., Java for
+// version 1), then an *ErrPrerequisiteMissing is returned. See MustMakeAnwork.
+func MakeAnwork(version Version, opts ...Option) (*Anwork, error) {
+	o := makeOptions(opts)
+
+	binary := o.binary
+	if binary == "" {
+		var err error
+		if binary, err = findAnworkBinary(version, o.logger); err != nil {
+			return nil, err
+		}
 	}
 
-	hash, err := getAnworkZipHash(path)
-	if err != nil {
-		return nil, err
+	anwork := &Anwork{
+		timeout:       o.timeout,
+		env:           o.env,
+		workingDir:    o.workingDir,
+		logger:        o.logger,
+		contextRoot:   o.contextRoot,
+		tb:            o.tb,
+		keepOnFailure: o.keepOnFailure && o.tb != nil,
+		validate:      o.validate,
 	}
 
-	reader, err := makeAnworkZipReader(path)
-	if err != nil {
+	// These paths are made absolute so that they still work when commands are run in another
+	// working directory.
+	var err error
+	if anwork.binaryPath, err = filepath.Abs(binary); err != nil {
 		return nil, err
 	}
-	defer reader.Close()
 
-	unzipPath := makeAnworkDestinationPath(hash)
-	err = unzip(reader, unzipPath)
-	if err != nil {
+	if err := checkPrerequisites(anwork.binaryPath, o.env); err != nil {
 		return nil, err
 	}
 
-	binary, exists := findBinary(version, unzipPath)
-	if !exists {
-		return nil, errors.New("Cannot find anwork binary at destinationPath: " + binary)
+	contextPath := o.contextDir
+	if contextPath == "" {
+		if contextPath, err = makeContextDir(anwork.contextRoot, anwork.tb); err != nil {
+			return nil, err
+		}
+		anwork.ownsContext = true
 	}
-
-	err = os.Chmod(binary, os.ModePerm)
-	if err != nil {
+	if anwork.contextPath, err = filepath.Abs(contextPath); err != nil {
 		return nil, err
 	}
 
-	contextPath, err := makeContextPath()
-	if err != nil {
-		return nil, err
+	if o.fixture != "" {
+		if err := copyFixture(o.fixture, anwork.contextPath); err != nil {
+			if anwork.ownsContext {
+				os.RemoveAll(anwork.contextPath)
+			}
+			return nil, err
+		}
+	}
+
+	if anwork.tb != nil {
+		anwork.tb.Cleanup(anwork.cleanup)
 	}
 
-	return &Anwork{contextPath: contextPath, binaryPath: binary}, nil
+	return anwork, nil
 }
 
 // Run a command with an instance of an anwork package. This function will return whatever the
-// command printed to stdout, or a non-nil error is something failed.
+// command printed to stdout, or a non-nil error is something failed. A command that exits with a
+// non-zero status is considered to have failed. See Execute for a more detailed view of the run.
 func (anwork *Anwork) Run(command ...string) (string, error) {
-	arguments := make([]string, 0, 2+len(command))
-	arguments = append(arguments, "-o", anwork.contextPath)
-	arguments = append(arguments, command...)
-	cmd := exec.Command(anwork.binaryPath, arguments...)
-	output, err := cmd.Output()
-	return string(output), err
-}
-
-// Close an Anwork instance, i.e., delete the context directory for this Anwork instance. This
-// Anwork instance will not be able to be used after this method is called.
-func (anwork *Anwork) Close() error {
-	err := os.RemoveAll(anwork.contextPath)
-	anwork.binaryPath = ""
-	return err
+	return anwork.RunContext(context.Background(), command...)
 }
 
-func makeAnworkZipPath(version int) string {
-	return fmt.Sprintf("%s/v%d/anwork-%d.zip", ReleasePath, version, version)
-}
-
-func getAnworkZipHash(path string) (string, error) {
-	contents, err := ioutil.ReadFile(path)
+// This method is the same as Run, except that the command will be killed if the provided context
+// is done before the command completes. See ExecuteContext.
+func (anwork *Anwork) RunContext(ctx context.Context, command ...string) (string, error) {
+	result, err := anwork.ExecuteContext(ctx, command...)
 	if err != nil {
 		return "", err
 	}
-
-	hash := md5.Sum(contents)
-	bytes := make([]string, len(hash))
-	for i, bite := range hash {
-		bytes[i] = fmt.Sprintf("%x", bite)
-	}
-
-	return strings.Join(bytes, ""), nil
+	return result.Stdout, result.Err()
 }
 
-func makeAnworkDestinationPath(hash string) string {
-	// This destination path is per executable so that we can run multiple test packages at the same
-	// time and the two packages won't stomp on each other.
-	executableName := path.Base(os.Args[0])
-	return fmt.Sprintf("../.anwork-%s-%s", executableName, hash)
+// Execute a command with an instance of an anwork package and return a RunResult describing what
+// happened. A command that runs to completion, regardless of its exit status, will not cause a
+// non-nil error to be returned; the exit status is reported in the RunResult. A non-nil error is
+// only returned when the command could not be run to completion (e.g., the binary is missing, or
+// the command timed out).
+func (anwork *Anwork) Execute(command ...string) (*RunResult, error) {
+	return anwork.ExecuteContext(context.Background(), command...)
 }
 
-func makeAnworkZipReader(path string) (*zip.ReadCloser, error) {
-	reader, err := zip.OpenReader(path)
-	return reader, err
+// This method is the same as Execute, except that the command will be killed if the provided
+// context is done before the command completes. The command will also be killed if it runs for
+// longer than the timeout of this Anwork instance (see SetTimeout). When a command is killed, the
+// command's whole process group is killed and a *TimeoutError is returned.
+func (anwork *Anwork) ExecuteContext(ctx context.Context, command ...string) (*RunResult, error) {
+	return anwork.execute(ctx, command, nil)
 }
 
-func unzip(reader *zip.ReadCloser, destinationPath string) error {
-	var err error = nil
+// This is the function that actually runs a command on an Anwork instance. If the provided setup
+// function is non-nil, then it is called with the command right before it is started. At that point
+// the command's Stdout and Stderr have already been set up to be captured into the RunResult.
+func (anwork *Anwork) execute(ctx context.Context, command []string, setup func(*exec.Cmd) error) (*RunResult, error) {
+	if anwork.binaryPath == "" {
+		return nil, errors.New("Anwork instance has no binary (has it been closed?)")
+	}
 
-	unzipMutex.Lock()
-	if _, err = os.Stat(destinationPath); os.IsNotExist(err) {
-		err = reallyUnzip(reader, destinationPath)
+	if anwork.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, anwork.timeout)
+		defer cancel()
 	}
-	unzipMutex.Unlock()
 
-	return err
-}
+	arguments := make([]string, 0, 2+len(command))
+	arguments = append(arguments, "-o", anwork.contextPath)
+	arguments = append(arguments, command...)
+	cmd := exec.CommandContext(ctx, anwork.binaryPath, arguments...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = time.Second
+	cmd.Dir = anwork.workingDir
+	if len(anwork.env) > 0 {
+		cmd.Env = append(os.Environ(), anwork.env...)
+	}
 
-func reallyUnzip(reader *zip.ReadCloser, path string) error {
-	// If the destination directory exists, then let's delete it.
-	if _, err := os.Stat(path); !os.IsNotExist(err) {
-		if err = os.RemoveAll(path); err != nil {
-			return errors.New("Anwork destination directory cannot be deleted: " + err.Error())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if setup != nil {
+		if err := setup(cmd); err != nil {
+			return nil, err
 		}
 	}
 
-	if err := os.Mkdir(path, os.ModeDir|os.ModePerm); err != nil {
-		return errors.New("Anwork destination directory cannot be created: " + err.Error())
+	start := time.Now()
+	err := cmd.Run()
+	result := &RunResult{
+		Args:     cmd.Args,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+	if err != nil && ctx.Err() != nil {
+		err = &TimeoutError{Result: result, Err: ctx.Err()}
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+		err = nil
+	}
+	if err == nil && anwork.validate {
+		err = anwork.validateContexts(result)
 	}
 
-	for _, file := range reader.File {
-		info := file.FileInfo()
-		var err error = nil
-		if info.IsDir() {
-			err = handleDir(path, file, &info)
-		} else {
-			err = handleFile(path, file, &info)
-		}
+	if anwork.logger != nil {
 		if err != nil {
-			return err
+			anwork.logger.Logf("Failed to run '%s': %s", strings.Join(command, " "), err)
+		} else {
+			anwork.logger.Logf("Ran %s\nstdout:\n%s\nstderr:\n%s", result, result.Stdout, result.Stderr)
 		}
 	}
 
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Returns an *InvalidContextError if any context file in the context directory of this Anwork
+// instance is invalid after the command with the provided result.
+func (anwork *Anwork) validateContexts(result *RunResult) error {
+	infos, err := ioutil.ReadDir(anwork.contextPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(anwork.contextPath, info.Name())
+		if err := anworkcontext.ValidateFile(path); err != nil {
+			return &InvalidContextError{Result: result, Path: path, Err: err}
+		}
+	}
 	return nil
 }
 
-func handleDir(destinationPath string, file *zip.File, info *os.FileInfo) error {
-	dirPath := path.Join(destinationPath, file.Name)
-	return os.Mkdir(dirPath, os.ModeDir|os.ModePerm)
+// Set the amount of time that a single command is allowed to run on this Anwork instance before it
+// is killed. A timeout of 0 means that commands are allowed to run forever. The default timeout for
+// an Anwork instance is DefaultTimeout.
+func (anwork *Anwork) SetTimeout(timeout time.Duration) {
+	anwork.timeout = timeout
 }
 
-func handleFile(destinationPath string, file *zip.File, info *os.FileInfo) error {
-	filePath := path.Join(destinationPath, file.Name)
-	osFile, err := os.Create(filePath)
+func (anwork *Anwork) String() string {
+	return fmt.Sprintf("Anwork{binary: %s, context: %s}", anwork.binaryPath, anwork.contextPath)
+}
+
+// Returns the state that anwork has persisted in the default context of this Anwork instance, i.e.,
+// its tasks and its journal. This lets a test check what anwork actually stored, instead of how
+// "anwork show" formats it. An Anwork instance that has not run any commands has the empty state.
+func (anwork *Anwork) State() (*anworkcontext.State, error) {
+	return anworkcontext.ReadFile(filepath.Join(anwork.contextPath, defaultContextName))
+}
+
+// Make it look like the provided amount of time has passed since the commands that this Anwork
+// instance has run so far, by moving every time in its default context (see State) that far into
+// the past. This lets a test check how anwork reports elapsed time (e.g., "anwork summary") without
+// waiting. Commands that are run afterwards use the real time, so
+//
+//	anwork.Run("create", "task-a")
+//	anwork.ElapseTime(2 * time.Hour)
+//	anwork.Run("set-finished", "task-a")
+//
+// makes task-a take 2 hours.
+func (anwork *Anwork) ElapseTime(d time.Duration) error {
+	path := filepath.Join(anwork.contextPath, defaultContextName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	state, err := anworkcontext.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer osFile.Close()
+	state.Shift(-d)
+	return anworkcontext.WriteFile(path, state)
+}
 
-	ioReader, err := file.Open()
+// This method is the same as Execute, except that it also returns what the command changed in the
+// default context of this Anwork instance (see State).
+func (anwork *Anwork) ExecuteDelta(command ...string) (*RunResult, *anworkcontext.Delta, error) {
+	before, err := anwork.State()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer ioReader.Close()
 
-	buffer := make([]byte, 1024) // read size
-	for {
-		readCount, err := ioReader.Read(buffer)
-		if readCount > 0 {
-			_, err := osFile.Write(buffer[:readCount])
-			if err != nil {
-				return nil
-			}
-		}
+	result, err := anwork.Execute(command...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after, err := anwork.State()
+	if err != nil {
+		return result, nil, err
+	}
+	return result, anworkcontext.Diff(before, after), nil
+}
+
+// Close an Anwork instance, i.e., delete the context directory for this Anwork instance (unless it
+// was provided via WithContextDir). This Anwork instance will not be able to be used after this
+// method is called. It is fine to call this method more than once.
+//
+// If the Anwork instance keeps its context directory when its test fails (see WithKeepOnFailure),
+// then the context directory is not deleted until the test finishes.
+func (anwork *Anwork) Close() error {
+	var err error
+	if anwork.ownsContext && !anwork.keepOnFailure {
+		err = os.RemoveAll(anwork.contextPath)
+	}
+	anwork.binaryPath = ""
+	return err
+}
+
+// This is called when the test that this Anwork instance belongs to finishes (see WithCleanup).
+func (anwork *Anwork) cleanup() {
+	if anwork.keepOnFailure && anwork.ownsContext && anwork.tb.Failed() {
+		anwork.tb.Logf("Keeping context directory %s of failed test", anwork.contextPath)
+		anwork.binaryPath = ""
+		return
+	}
+
+	anwork.keepOnFailure = false
+	if err := anwork.Close(); err != nil {
+		anwork.tb.Errorf("Could not delete context directory %s: %s", anwork.contextPath, err)
+	}
+}
 
+// Returns the path to the anwork binary for the provided version. If a LocalBuild is in use for
+// this version, then the local binary is returned. Otherwise, the binary comes from the configured
+// ReleaseSource (see getReleaseSource).
+func findAnworkBinary(version Version, logger Logger) (string, error) {
+	if build := getLocalBuild(); build != nil {
+		binary, localVersion, err := build.Resolve()
 		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return err
+			return "", err
+		} else if localVersion.Equal(version) {
+			if logger != nil {
+				logger.Logf("Using %s (version %s)", build, version)
 			}
+			return binary, nil
 		}
 	}
 
-	return nil
+	source, err := getReleaseSource()
+	if err != nil {
+		return "", err
+	}
+	return source.Binary(version)
 }
 
-func findBinary(version int, packageRoot string) (string, bool) {
-	packageName := fmt.Sprintf("anwork-%d", version)
-	binaryPath := path.Join(packageRoot, packageName, "bin", "anwork")
+// Returns the path to the anwork binary in the provided release root (i.e., the anwork-X directory
+// from a release zip), and whether or not it exists.
+//
+// Multi-platform releases have a bin/anwork_GOOS_GOARCH binary for every platform, along with a
+// bin/anwork script that runs "go env" to pick one of them on every command. The binary for this
+// platform is used directly when it exists, so that commands do not pay for "go env" (or need Go to
+// be installed at all). Otherwise, bin/anwork is used.
+func findBinary(releaseRoot string) (string, bool) {
+	platformPath := path.Join(releaseRoot, "bin", platformBinaryName(runtime.GOOS, runtime.GOARCH))
+	if info, err := os.Stat(platformPath); err == nil && isExecutable(info) {
+		return platformPath, true
+	}
+
+	binaryPath := path.Join(releaseRoot, "bin", "anwork")
 	_, err := os.Stat(binaryPath)
 	return binaryPath, !os.IsNotExist(err)
 }
 
-func makeContextPath() (string, error) {
-	maxRandom := big.NewInt(math.MaxUint16)
-	random, err := rand.Int(rand.Reader, maxRandom)
+// Returns the name of the anwork binary for the provided platform in a multi-platform release, e.g.,
+// anwork_linux_amd64.
+func platformBinaryName(goos, goarch string) string {
+	name := fmt.Sprintf("anwork_%s_%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Returns true iff the provided file is a regular file that can be executed.
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && (runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0)
+}
+
+// This is the prefix of the name of every context directory that makeContextDir creates. It is
+// distinct from the anwork-X directories in unpacked releases, so that RemoveOrphanedContexts never
+// mistakes one for the other.
+const contextDirPrefix = "anwork-context-"
+
+// Create a new, empty context directory in the provided root directory, or in ContextRoot if the
+// root is empty. The directory is named after the provided test, if there is one.
+func makeContextDir(root string, t testing.TB) (string, error) {
+	if root == "" {
+		root = ContextRoot()
+	}
+	if err := os.MkdirAll(root, os.ModeDir|os.ModePerm); err != nil {
+		return "", errors.New("Cannot create context root: " + err.Error())
+	}
+
+	pattern := contextDirPrefix
+	if t != nil {
+		pattern += contextNameRegex.ReplaceAllString(t.Name(), "_") + "-"
+	}
+	return os.MkdirTemp(root, pattern)
+}
+
+// Copy the provided fixture context file into the provided context directory as the default context.
+func copyFixture(fixture, contextPath string) error {
+	contents, err := ioutil.ReadFile(fixture)
 	if err != nil {
-		return "", err
+		return errors.New("Cannot read fixture: " + err.Error())
 	}
-	path := fmt.Sprintf("tmp_%04x", random.Int64())
 
-	// If the destination path exists, let's blow up!
-	if _, err = os.Stat(path); !os.IsNotExist(err) {
-		return "", errors.New("Context directory already exists!")
+	if err := os.MkdirAll(contextPath, os.ModeDir|os.ModePerm); err != nil {
+		return errors.New("Cannot create context directory: " + err.Error())
 	}
 
-	return path, nil
+	return ioutil.WriteFile(filepath.Join(contextPath, defaultContextName), contents, 0644)
+}
+
+// This is the regular expression that matches the characters in a test name that should not be
+// used in a directory name.
+var contextNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Returns the directory that context directories are created in by default, i.e., the value of the
+// ContextRootEnv environment variable, or an anwork_testing directory in the temp directory.
+func ContextRoot() string {
+	if root := os.Getenv(ContextRootEnv); root != "" {
+		return root
+	}
+	return filepath.Join(os.TempDir(), "anwork_testing")
 }
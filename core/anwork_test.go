@@ -1,35 +1,40 @@
 package core
 
 import (
-	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
 )
 
 const (
 	testZipPath      = "data/test.zip"
 	otherTestZipPath = "data/other.zip"
-
-	defaultVersion = 2
 )
 
+var defaultVersion = MajorVersion(2)
+
 func TestMakeAnwork(t *testing.T) {
 	t.Parallel()
 
-	for version := 1; true; version++ {
-		if !fileExists(makeAnworkZipPath(version)) {
-			break
-		}
-
-		t.Run(fmt.Sprintf("Version%d", version), func(t *testing.T) {
-			anwork, err := MakeAnwork(version)
-			if err != nil {
-				t.Fatal("Failed to make anwork struct: ", err)
-			}
+	releases, err := mustGetReleaseDir(t).Releases()
+	if err != nil {
+		t.Fatal("Cannot list releases:", err)
+	}
+	for _, release := range releases {
+		version := release.Version
+		t.Run(fmt.Sprintf("Version%s", version), func(t *testing.T) {
+			anwork := MustMakeAnwork(t, version)
 			defer anwork.Close()
 
 			out, err := anwork.Run("version")
@@ -42,6 +47,160 @@ func TestMakeAnwork(t *testing.T) {
 	}
 }
 
+func TestPlatformBinary(t *testing.T) {
+	t.Parallel()
+
+	anwork, err := MakeAnwork(defaultVersion)
+	if err != nil {
+		t.Fatal("Failed to make anwork struct:", err)
+	}
+	defer anwork.Close()
+
+	binDir := filepath.Dir(anwork.binaryPath)
+	if filepath.Base(anwork.binaryPath) != platformBinaryName(runtime.GOOS, runtime.GOARCH) {
+		t.Skipf("Skipping TestPlatformBinary because version %s has no %s/%s binary (using %s)",
+			defaultVersion, runtime.GOOS, runtime.GOARCH, anwork.binaryPath)
+	}
+
+	// Run the same commands through the bin/anwork wrapper script, with its own context.
+	wrapperContext := mustMakeTmpDir(t, "anwork-wrapper")
+	defer os.RemoveAll(wrapperContext)
+	wrapper, err := MakeAnwork(defaultVersion, WithContextDir(wrapperContext))
+	if err != nil {
+		t.Fatal("Failed to make anwork struct:", err)
+	}
+	defer wrapper.Close()
+	wrapper.binaryPath = filepath.Join(binDir, "anwork")
+
+	commands := [][]string{
+		{"version"},
+		{"create", "task-a"},
+		{"create", "task-b"},
+		{"set-running", "task-a"},
+		{"show"},
+		{"show", "nope"},
+	}
+	for _, command := range commands {
+		platformResult, err := anwork.Execute(command...)
+		if err != nil {
+			t.Fatal("Failed to run platform binary:", err)
+		}
+		wrapperResult, err := wrapper.Execute(command...)
+		if err != nil {
+			t.Fatal("Failed to run wrapper script:", err)
+		}
+
+		if platformResult.Stdout != wrapperResult.Stdout || platformResult.ExitCode != wrapperResult.ExitCode {
+			t.Errorf("Command %v behaved differently: platform binary printed %q (exit %d), wrapper "+
+				"script printed %q (exit %d)", command, platformResult.Stdout, platformResult.ExitCode,
+				wrapperResult.Stdout, wrapperResult.ExitCode)
+		}
+	}
+}
+
+func TestContextDirs(t *testing.T) {
+	t.Parallel()
+
+	root := mustMakeTmpDir(t, "anwork-contexts")
+	defer os.RemoveAll(root)
+
+	const count = 100
+	paths := make(chan string, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			anwork, err := MakeAnwork(defaultVersion, WithContextRoot(root))
+			if err != nil {
+				t.Error("Failed to make anwork struct:", err)
+				return
+			}
+			paths <- anwork.contextPath
+		}()
+	}
+	wg.Wait()
+	close(paths)
+
+	seen := map[string]bool{}
+	for path := range paths {
+		if seen[path] {
+			t.Errorf("Context directory %s was used twice", path)
+		} else if filepath.Dir(path) != root {
+			t.Errorf("Expected context directory %s to be in %s", path, root)
+		} else if !fileExists(path) {
+			t.Errorf("Expected context directory %s to exist", path)
+		}
+		seen[path] = true
+	}
+}
+
+func TestContextCleanup(t *testing.T) {
+	t.Parallel()
+
+	root := mustMakeTmpDir(t, "anwork-contexts")
+	defer os.RemoveAll(root)
+
+	// A test that forgets to call Close should still have its context directory deleted.
+	var contextPath string
+	t.Run("Forgetful", func(t *testing.T) {
+		anwork := MustMakeAnwork(t, defaultVersion, WithContextRoot(root))
+		contextPath = anwork.contextPath
+		if !strings.Contains(filepath.Base(contextPath), "Forgetful") {
+			t.Errorf("Expected context directory %s to be named after the test", contextPath)
+		}
+		if _, err := anwork.Run("create", "task-a"); err != nil {
+			t.Fatal("Failed to run anwork command:", err)
+		}
+	})
+	if fileExists(contextPath) {
+		t.Errorf("Expected context directory %s to be deleted after the test", contextPath)
+	}
+
+	for _, failed := range []bool{false, true} {
+		tb := &cleanupRecorder{TB: t, failed: failed}
+		anwork, err := MakeAnwork(defaultVersion, WithContextRoot(root), WithCleanup(tb), WithKeepOnFailure(true))
+		if err != nil {
+			t.Fatal("Failed to make anwork struct:", err)
+		}
+		if _, err := anwork.Run("create", "task-a"); err != nil {
+			t.Fatal("Failed to run anwork command:", err)
+		}
+		anwork.Close()
+		if !fileExists(anwork.contextPath) {
+			t.Errorf("Expected context directory %s to be kept until the test finishes", anwork.contextPath)
+		}
+
+		tb.runCleanups()
+		if kept := fileExists(anwork.contextPath); kept != failed {
+			t.Errorf("Expected context directory to be kept: %t (test failed: %t), but kept: %t", failed,
+				failed, kept)
+		}
+	}
+}
+
+// This is a testing.TB that pretends to have passed or failed, and that runs its cleanup functions
+// when asked to.
+type cleanupRecorder struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+}
+
+func (recorder *cleanupRecorder) Failed() bool {
+	return recorder.failed
+}
+
+func (recorder *cleanupRecorder) Cleanup(f func()) {
+	recorder.cleanups = append(recorder.cleanups, f)
+}
+
+func (recorder *cleanupRecorder) runCleanups() {
+	for i := len(recorder.cleanups) - 1; i >= 0; i-- {
+		recorder.cleanups[i]()
+	}
+}
+
 func TestCloseAnwork(t *testing.T) {
 	t.Parallel()
 
@@ -58,6 +217,231 @@ func TestCloseAnwork(t *testing.T) {
 	}
 }
 
+func TestExecute(t *testing.T) {
+	t.Parallel()
+
+	anwork, err := MakeAnwork(defaultVersion)
+	if err != nil {
+		t.Fatal("Failed to make anwork struct:", err)
+	}
+	defer anwork.Close()
+
+	t.Run("Success", func(t *testing.T) {
+		result, err := anwork.Execute("version")
+		if err != nil {
+			t.Fatal("Failed to execute anwork command:", err)
+		}
+		t.Logf("Got result: %s", result)
+		if !result.Success() || result.Err() != nil {
+			t.Errorf("Expected command to succeed, got exit code %d", result.ExitCode)
+		}
+		if len(result.Stdout) == 0 {
+			t.Error("Expected output on stdout from the version command")
+		}
+		if result.Args[0] != anwork.binaryPath || result.Args[len(result.Args)-1] != "version" {
+			t.Errorf("Unexpected argument vector: %s", result.Args)
+		}
+		if result.Duration <= 0 {
+			t.Errorf("Expected a positive duration, got %s", result.Duration)
+		}
+	})
+	t.Run("Failure", func(t *testing.T) {
+		result, err := anwork.Execute("show", "this-task-does-not-exist")
+		if err != nil {
+			t.Fatal("Failed to execute anwork command:", err)
+		}
+		t.Logf("Got result: %s", result)
+		if result.Success() || result.Err() == nil {
+			t.Error("Expected command to fail")
+		}
+		if !strings.Contains(result.Stderr, "this-task-does-not-exist") {
+			t.Errorf("Expected task name in stderr, got: %s", result.Stderr)
+		}
+		if _, err := anwork.Run("show", "this-task-does-not-exist"); err == nil {
+			t.Error("Expected Run to return an error for a failed command")
+		}
+	})
+	t.Run("MissingBinary", func(t *testing.T) {
+		missing := &Anwork{contextPath: anwork.contextPath, binaryPath: "this/path/does/not/exist"}
+		if _, err := missing.Execute("version"); err == nil {
+			t.Error("Expected an error from executing a missing binary")
+		}
+	})
+}
+
+func TestWithBinary(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestWithBinary on windows because it uses a shell script")
+	}
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-binary")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// There is no release for this version, so the binary can only come from WithBinary.
+	binary := path.Join(tmpDirPath, "anwork")
+	script := "#!/bin/sh\necho fake anwork: \"$@\"\n"
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal("Could not write fake binary:", err)
+	}
+	anwork := MustMakeAnwork(t, MajorVersion(99), WithBinary(binary))
+
+	output, err := anwork.Run("create", "task-a")
+	if err != nil {
+		t.Fatal("Could not run fake binary:", err)
+	}
+	expected := fmt.Sprintf("fake anwork: -o %s create task-a\n", anwork.contextPath)
+	if output != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, output)
+	}
+
+	if _, err := MakeAnwork(MajorVersion(99), WithBinary(path.Join(tmpDirPath, "missing"))); err == nil {
+		t.Error("Expected error from making anwork with a missing binary")
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestExecuteTimeout on windows because it uses a shell script")
+	}
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-timeout")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// This script spawns a child that never exits, so it will never complete on its own.
+	binary := path.Join(tmpDirPath, "anwork")
+	script := "#!/bin/sh\necho hanging\nsleep 600 &\nwait\n"
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal("Could not write hanging script:", err)
+	}
+	anwork := &Anwork{contextPath: path.Join(tmpDirPath, "context"), binaryPath: binary}
+
+	t.Run("Timeout", func(t *testing.T) {
+		anwork.SetTimeout(100 * time.Millisecond)
+		start := time.Now()
+		_, err := anwork.Execute("version")
+		checkTimeoutError(t, err, context.DeadlineExceeded)
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Timeout took way too long: %s", elapsed)
+		}
+	})
+	t.Run("Context", func(t *testing.T) {
+		anwork.SetTimeout(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err := anwork.ExecuteContext(ctx, "version")
+		checkTimeoutError(t, err, context.Canceled)
+	})
+}
+
+func checkTimeoutError(t *testing.T, err error, reason error) {
+	timeoutErr, ok := err.(*TimeoutError)
+	if !ok {
+		t.Fatalf("Expected a *TimeoutError, got %#v", err)
+	}
+	t.Logf("Got timeout error: %s", timeoutErr)
+	if timeoutErr.Err != reason {
+		t.Errorf("Expected timeout reason %s, got %s", reason, timeoutErr.Err)
+	}
+	if !strings.Contains(timeoutErr.Error(), "version") {
+		t.Errorf("Expected command in error message: %s", timeoutErr)
+	}
+	if timeoutErr.Result.Stdout != "hanging\n" {
+		t.Errorf("Expected partial output in error, got '%s'", timeoutErr.Result.Stdout)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-options")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	contextDir := path.Join(tmpDirPath, "context")
+	logger := &recordingLogger{}
+	anwork, err := MakeAnwork(defaultVersion,
+		WithContextDir(contextDir),
+		WithTimeout(time.Hour),
+		WithLogger(logger))
+	if err != nil {
+		t.Fatal("Failed to make anwork struct:", err)
+	}
+
+	if anwork.timeout != time.Hour {
+		t.Errorf("Expected timeout to be %s, got %s", time.Hour, anwork.timeout)
+	}
+
+	if _, err := anwork.Run("create", "task-a"); err != nil {
+		t.Fatal("Failed to run anwork command:", err)
+	}
+	if !fileExists(path.Join(contextDir, "default-context")) {
+		t.Errorf("Expected context to be written to %s", contextDir)
+	}
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "create task-a") {
+		t.Errorf("Expected command to be logged, got %s", logger.messages)
+	}
+
+	if err := anwork.Close(); err != nil {
+		t.Fatal("Failed to close anwork struct:", err)
+	}
+	if !fileExists(contextDir) {
+		t.Errorf("Expected context dir %s to survive Close", contextDir)
+	}
+}
+
+func TestEnvAndWorkingDirOptions(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestEnvAndWorkingDirOptions on windows because it uses a shell script")
+	}
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-options")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	if tmpDirPath, err = filepath.EvalSymlinks(tmpDirPath); err != nil {
+		t.Fatal("Could not resolve tmp directory:", err)
+	}
+
+	binary := path.Join(tmpDirPath, "anwork")
+	script := "#!/bin/sh\npwd\necho $ANWORK_TESTING_FOO\n"
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal("Could not write script:", err)
+	}
+
+	opts := makeOptions([]Option{
+		WithEnv("ANWORK_TESTING_FOO=bar", "ANWORK_TESTING_FOO=baz"),
+		WithWorkingDir(tmpDirPath),
+	})
+	anwork := &Anwork{binaryPath: binary, contextPath: "context", env: opts.env, workingDir: opts.workingDir}
+	output, err := anwork.Run("version")
+	if err != nil {
+		t.Fatal("Failed to run script:", err)
+	}
+	if expected := tmpDirPath + "\nbaz\n"; output != expected {
+		t.Errorf("Expected output '%s', got '%s'", expected, output)
+	}
+}
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (logger *recordingLogger) Logf(format string, args ...interface{}) {
+	logger.messages = append(logger.messages, fmt.Sprintf(format, args...))
+}
+
 func TestParallelAnworkCreation(t *testing.T) {
 	const anworksCount = 4
 	anworkChan := make(chan *Anwork, anworksCount)
@@ -179,8 +563,8 @@ func TestParallelAnworkCreationAndRunning(t *testing.T) {
 func TestAnworkZipPath(t *testing.T) {
 	t.Parallel()
 
-	path := makeAnworkZipPath(defaultVersion)
-	if !fileExists(path) {
+	path, err := mustGetReleaseDir(t).ArchivePath(defaultVersion)
+	if err != nil || !fileExists(path) {
 		t.Fatal("Zip path (", path, ") does not exist")
 	}
 }
@@ -223,8 +607,11 @@ func TestAnworkZipHash(t *testing.T) {
 func TestAnworkZipReaderCreation(t *testing.T) {
 	t.Parallel()
 
-	path := makeAnworkZipPath(defaultVersion)
-	_, err := makeAnworkZipReader(path)
+	path, err := mustGetReleaseDir(t).ArchivePath(defaultVersion)
+	if err != nil {
+		t.Fatal("Cannot find zip path:", err)
+	}
+	_, err = makeAnworkZipReader(path)
 	if err != nil {
 		t.Fatal("Zip reader cannot be created from path (", path, "):", err)
 	}
@@ -233,19 +620,10 @@ func TestAnworkZipReaderCreation(t *testing.T) {
 func TestUnzip(t *testing.T) {
 	t.Parallel()
 
-	reader, err := zip.OpenReader(testZipPath)
-	if err != nil {
-		t.Fatal("Cannot create reader for zipfile:", err)
-	}
-	defer reader.Close()
-
 	tmpDirPath := "tmp"
-	if err = os.Mkdir(tmpDirPath, os.ModeDir|os.ModePerm); err != nil {
-		t.Fatal("Could not create tmp directory:", err)
-	}
 	defer os.RemoveAll(tmpDirPath)
 
-	err = reallyUnzip(reader, tmpDirPath)
+	err := extractArchive(testZipPath, tmpDirPath)
 	if err != nil {
 		t.Fatal("Did not unzip file successfully:", err)
 	}
@@ -258,19 +636,13 @@ func TestUnzip(t *testing.T) {
 		return nil
 	})
 
-	// This map mimics the file tree in the test.zip file.
-	fileTree := map[string][]string{
-		"":      []string{"file-1", "file-2"},
-		"dir-a": []string{"file-a-1", "file-a-2"},
-		"dir-b": []string{"file-b-1"},
-	}
-	checkFileTree(t, path.Join(tmpDirPath, "test"), fileTree)
+	checkFileTree(t, path.Join(tmpDirPath, "test"), testZipFileTree)
 }
 
 func TestNonExistentAnworkVersion(t *testing.T) {
 	t.Parallel()
 
-	_, err := MakeAnwork(65535) // I sure hope this version never exists...
+	_, err := MakeAnwork(MajorVersion(65535)) // I sure hope this version never exists...
 	if err == nil {
 		t.Fatal("Should have received an error from bad anwork version!")
 	}
@@ -299,7 +671,116 @@ func checkFileTree(t *testing.T, root string, fileTree map[string][]string) {
 	}
 }
 
+func mustGetReleaseDir(t *testing.T) *DirSource {
+	releaseDir, err := findReleaseDir()
+	if err != nil {
+		t.Fatal("Cannot find release directory:", err)
+	}
+	return &DirSource{Path: releaseDir}
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
 }
+
+func TestAnworkState(t *testing.T) {
+	t.Parallel()
+
+	anwork := MustMakeAnwork(t, defaultVersion)
+	state, err := anwork.State()
+	if err != nil {
+		t.Fatal("Failed to get state:", err)
+	} else if len(state.Tasks) != 0 {
+		t.Errorf("Expected no tasks, got %d", len(state.Tasks))
+	}
+
+	for _, command := range [][]string{{"create", "task-a"}, {"set-priority", "task-a", "7"}} {
+		if _, err := anwork.Run(command...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state, err = anwork.State(); err != nil {
+		t.Fatal("Failed to get state:", err)
+	}
+	if task := state.Task("task-a"); task == nil || task.Priority != 7 {
+		t.Errorf("Expected task-a with priority 7, got %+v", task)
+	}
+	if len(state.Journal) != 2 {
+		t.Errorf("Expected 2 journal entries, got %d", len(state.Journal))
+	}
+}
+
+func TestElapseTime(t *testing.T) {
+	t.Parallel()
+
+	anwork := MustMakeAnwork(t, defaultVersion)
+	if err := anwork.ElapseTime(time.Hour); err != nil {
+		t.Error("Expected elapsing time before any commands to do nothing, got:", err)
+	}
+
+	if _, err := anwork.Run("create", "task-a"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := anwork.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := anwork.ElapseTime(48 * time.Hour); err != nil {
+		t.Fatal("Failed to elapse time:", err)
+	}
+	after, err := anwork.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := before.Tasks[0].Created.Add(-48 * time.Hour); !after.Tasks[0].Created.Equal(expected) {
+		t.Errorf("Expected task-a to be created at %s, got %s", expected, after.Tasks[0].Created)
+	}
+	if output, err := anwork.Run("show", "task-a"); err != nil {
+		t.Error("Expected anwork to read the shifted context, got:", err)
+	} else if expected := after.Tasks[0].Created.Format("Monday January 2"); !strings.Contains(output, expected) {
+		t.Errorf("Expected task-a to be created on %s, got:\n%s", expected, output)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	t.Parallel()
+
+	dir := mustMakeTmpDir(t, "anwork-validation")
+	defer os.RemoveAll(dir)
+
+	validated := MustMakeAnwork(t, defaultVersion, WithContextDir(dir), WithValidation(true))
+	unvalidated := MustMakeAnwork(t, defaultVersion, WithContextDir(dir), WithValidation(false))
+	for _, command := range [][]string{{"create", "task-a"}, {"create", "task-b"}, {"set-running", "task-b"}} {
+		if _, err := validated.Run(command...); err != nil {
+			t.Fatalf("Expected '%s' to leave a valid context, got: %s", strings.Join(command, " "), err)
+		}
+	}
+
+	// Corrupt the context by giving both tasks the same name.
+	state, err := validated.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Tasks[1].Name = state.Tasks[0].Name
+	if err := anworkcontext.WriteFile(filepath.Join(dir, defaultContextName), state); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := unvalidated.Run("show"); err != nil {
+		t.Error("Expected an Anwork instance without validation not to notice, got:", err)
+	}
+	_, err = validated.Run("show")
+	var invalid *InvalidContextError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected an *InvalidContextError, got %v", err)
+	}
+	if invalid.Result.Command() != "-o "+dir+" show" || invalid.Path != filepath.Join(dir, defaultContextName) {
+		t.Errorf("Expected error to be about the show command and the default context, got: %s", err)
+	}
+	var validationErr *anworkcontext.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 {
+		t.Errorf("Expected error to have a single validation problem, got: %s", err)
+	}
+}
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// These are the archive formats that a release can be packaged in.
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz"}
+
+// Returns true iff the provided path has the extension of a supported archive format.
+func isArchive(path string) bool {
+	for _, extension := range archiveExtensions {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// These are the limits that are enforced while extracting an archive, so that a corrupt or malicious
+// release cannot fill up the disk (i.e., a zip bomb).
+type archiveLimits struct {
+	maxEntries   int
+	maxFileSize  int64
+	maxTotalSize int64
+}
+
+// These are the limits that are used for every release archive. An anwork release is a handful of
+// files that are a few megabytes each, so these are very generous.
+var defaultArchiveLimits = archiveLimits{
+	maxEntries:   10000,
+	maxFileSize:  1 << 30, // 1 GiB
+	maxTotalSize: 4 << 30, // 4 GiB
+}
+
+// Extract the provided zip or tar.gz archive into the provided destination path. If the destination
+// path already exists, it is deleted first. This function does no locking; see unpackIntoCache.
+func extractArchive(archivePath, destinationPath string) error {
+	return extractArchiveWithLimits(archivePath, destinationPath, defaultArchiveLimits)
+}
+
+// This is the same as extractArchive, except that the provided limits are enforced. Every entry is
+// checked before it is written: entries that would end up outside of the destination path (e.g.,
+// "../../.bashrc"), symlinks that point outside of it (directly or through another symlink in the
+// archive), and entries that live underneath a symlink are rejected. File modes and symlinks are
+// kept as they are in the archive.
+func extractArchiveWithLimits(archivePath, destinationPath string, limits archiveLimits) error {
+	if err := os.RemoveAll(destinationPath); err != nil {
+		return errors.New("Anwork destination directory cannot be deleted: " + err.Error())
+	}
+	if err := os.Mkdir(destinationPath, os.ModeDir|os.ModePerm); err != nil {
+		return errors.New("Anwork destination directory cannot be created: " + err.Error())
+	}
+
+	entries := 0
+	var totalSize int64 = 0
+	symlinks := map[string]string{} // name -> target
+	err := walkArchive(archivePath, func(entry *archiveEntry) error {
+		entries++
+		if entries > limits.maxEntries {
+			return fmt.Errorf("Archive %s has more than %d entries", archivePath, limits.maxEntries)
+		}
+
+		name, err := cleanEntryName(entry.Name)
+		if err != nil {
+			return err
+		}
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if _, ok := symlinks[parent]; ok {
+				return fmt.Errorf("Archive entry '%s' is inside of symlink '%s'", entry.Name, parent)
+			}
+		}
+		entryPath := filepath.Join(destinationPath, filepath.FromSlash(name))
+
+		mode := entry.Info.Mode()
+		switch {
+		case mode.IsDir():
+			return extractDir(entryPath, mode)
+		case mode&os.ModeSymlink != 0:
+			if err := checkSymlinkTarget(name, entry.Linkname, symlinks); err != nil {
+				return err
+			}
+			symlinks[name] = entry.Linkname
+			return extractSymlink(entryPath, name, entry.Linkname)
+		case mode.IsRegular():
+			if entry.Info.Size() > limits.maxFileSize {
+				return fmt.Errorf("Archive entry '%s' is larger than %d bytes", entry.Name, limits.maxFileSize)
+			}
+			written, err := extractFile(entryPath, mode, entry.Reader, limits.maxFileSize)
+			if err != nil {
+				return fmt.Errorf("Cannot extract archive entry '%s': %s", entry.Name, err.Error())
+			}
+			totalSize += written
+			if totalSize > limits.maxTotalSize {
+				return fmt.Errorf("Archive %s is larger than %d bytes", archivePath, limits.maxTotalSize)
+			}
+			return nil
+		default:
+			return fmt.Errorf("Archive entry '%s' has unsupported type %s", entry.Name, mode.Type())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// A symlink that comes later in the archive can change where an earlier symlink's target
+	// resolves to (e.g., "x -> sub/.." and then "sub -> ."), so check every target again now that
+	// all of the symlinks are known.
+	for name, target := range symlinks {
+		if err := checkSymlinkTarget(name, target, symlinks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the provided archive entry name in clean form, or an error if the entry would not end up
+// inside of the directory that the archive is being extracted into.
+func cleanEntryName(name string) (string, error) {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("Archive entry '%s' has an unsafe path", name)
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("Archive entry '%s' is outside of the destination directory", name)
+	}
+	return name, nil
+}
+
+func extractDir(dirPath string, mode os.FileMode) error {
+	// Make sure that we can always write the rest of the archive into the directory.
+	perm := mode.Perm() | 0700
+	if err := os.MkdirAll(dirPath, os.ModeDir|perm); err != nil {
+		return err
+	}
+	return os.Chmod(dirPath, perm)
+}
+
+// Returns an error if the target of the provided symlink entry is unsafe, i.e., if it is absolute,
+// if it points outside of the destination directory, or if it goes through one of the provided
+// symlinks (which are keyed by entry name) that have been extracted. The target is resolved one
+// component at a time, since a ".." after a symlink goes to the parent of wherever that symlink
+// points, not to the parent of the symlink itself. The last component of the target can be a
+// symlink, since that symlink's own target is checked too.
+func checkSymlinkTarget(name, target string, symlinks map[string]string) error {
+	if target == "" || path.IsAbs(target) || strings.Contains(target, "\\") {
+		return fmt.Errorf("Archive symlink '%s' has unsafe target '%s'", name, target)
+	}
+
+	components := strings.Split(target, "/")
+	resolved := path.Dir(name)
+	for i, component := range components {
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "." {
+				return fmt.Errorf("Archive symlink '%s' points outside of the destination directory (%s)",
+					name, target)
+			}
+			resolved = path.Dir(resolved)
+		default:
+			resolved = path.Join(resolved, component)
+		}
+
+		if _, ok := symlinks[resolved]; ok && !onlyDots(components[i+1:]) {
+			return fmt.Errorf("Archive symlink '%s' has target '%s', which goes through symlink '%s'",
+				name, target, resolved)
+		}
+	}
+	return nil
+}
+
+// Returns true iff the provided path components are all empty or ".".
+func onlyDots(components []string) bool {
+	for _, component := range components {
+		if component != "" && component != "." {
+			return false
+		}
+	}
+	return true
+}
+
+func extractSymlink(linkPath, name, target string) error {
+	if err := os.MkdirAll(filepath.Dir(linkPath), os.ModeDir|0755); err != nil {
+		return err
+	}
+	return os.Symlink(target, linkPath)
+}
+
+// Write the provided reader into a new file, failing if more than maxSize bytes are read. The file is
+// created exclusively so that an archive with duplicate entries cannot write through a symlink that
+// it already created. Returns the number of bytes written.
+func extractFile(filePath string, mode os.FileMode, reader io.Reader, maxSize int64) (int64, error) {
+	// Archives do not always have entries for every directory.
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModeDir|0755); err != nil {
+		return 0, err
+	}
+
+	osFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(osFile, io.LimitReader(reader, maxSize+1))
+	if err == nil && written > maxSize {
+		err = fmt.Errorf("file is larger than %d bytes", maxSize)
+	}
+	if err == nil {
+		// The umask might have taken some of the mode bits away.
+		err = osFile.Chmod(mode.Perm())
+	}
+	if closeErr := osFile.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// Returns the hash of the provided release archive, which is used as its name in the cache. See
+// hashFile.
+func getAnworkZipHash(path string) (string, error) {
+	return hashFile(path)
+}
+
+func makeAnworkZipReader(path string) (*zip.ReadCloser, error) {
+	reader, err := zip.OpenReader(path)
+	return reader, err
+}
+
+// This is an entry in a zip or tar.gz archive.
+type archiveEntry struct {
+	// This is the name of the entry in the archive, e.g., "anwork-2/bin/anwork".
+	Name string
+	// This is the FileInfo describing the entry.
+	Info os.FileInfo
+	// This is the target of the entry if it is a symlink.
+	Linkname string
+	// This is the contents of the entry if it is a regular file.
+	Reader io.Reader
+}
+
+// This is the longest symlink target that will be read out of a zip archive.
+const maxLinknameSize = 4096
+
+// Call the provided function for every entry in the provided zip or tar.gz archive. The entry passed
+// to the function can only be used during the call.
+func walkArchive(archivePath string, f func(entry *archiveEntry) error) error {
+	if strings.HasSuffix(archivePath, ".zip") {
+		reader, err := makeAnworkZipReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		for _, file := range reader.File {
+			fileReader, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = walkZipFile(file, fileReader, f)
+			fileReader.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeLink:
+			return fmt.Errorf("Archive entry '%s' is a hard link, which is not supported", header.Name)
+		}
+
+		entry := &archiveEntry{
+			Name:     header.Name,
+			Info:     header.FileInfo(),
+			Linkname: header.Linkname,
+			Reader:   tarReader,
+		}
+		if err := f(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZipFile(file *zip.File, reader io.Reader, f func(entry *archiveEntry) error) error {
+	entry := &archiveEntry{
+		Name:   file.Name,
+		Info:   file.FileInfo(),
+		Reader: reader,
+	}
+
+	// Zip archives store the target of a symlink as its contents.
+	if entry.Info.Mode()&os.ModeSymlink != 0 {
+		linkname, err := ioutil.ReadAll(io.LimitReader(reader, maxLinknameSize))
+		if err != nil {
+			return err
+		}
+		entry.Linkname = string(linkname)
+	}
+
+	return f(entry)
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// This is an entry in an archive that is written by writeTestZip or writeTestTarball.
+type testArchiveEntry struct {
+	name     string
+	mode     os.FileMode
+	contents string // or symlink target
+}
+
+func TestExtractArchiveModesAndSymlinks(t *testing.T) {
+	t.Parallel()
+
+	entries := []testArchiveEntry{
+		{"release/", os.ModeDir | 0755, ""},
+		{"release/bin/anwork", 0755, "#!/bin/sh\n"},
+		{"release/doc/CLI.md", 0644, "# CLI\n"},
+		{"release/doc/latest.md", os.ModeSymlink | 0777, "CLI.md"},
+	}
+	for _, extension := range []string{".zip", ".tar.gz"} {
+		extension := extension
+		t.Run(extension, func(t *testing.T) {
+			t.Parallel()
+
+			tmpDir := mustMakeTmpDir(t, "anwork-archive")
+			defer os.RemoveAll(tmpDir)
+			archivePath := filepath.Join(tmpDir, "release"+extension)
+			writeTestArchive(t, archivePath, entries)
+
+			destinationPath := filepath.Join(tmpDir, "dest")
+			if err := extractArchive(archivePath, destinationPath); err != nil {
+				t.Fatal("Could not extract archive:", err)
+			}
+
+			for _, entry := range entries {
+				entryPath := filepath.Join(destinationPath, entry.name)
+				info, err := os.Lstat(entryPath)
+				if err != nil {
+					t.Error("Could not stat extracted entry:", err)
+				} else if info.Mode().Type() != entry.mode.Type() {
+					t.Errorf("Expected %s to have type %s, got %s", entry.name, entry.mode.Type(), info.Mode().Type())
+				} else if info.Mode().IsRegular() && info.Mode().Perm() != entry.mode.Perm() {
+					t.Errorf("Expected %s to have mode %s, got %s", entry.name, entry.mode.Perm(), info.Mode().Perm())
+				}
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join(destinationPath, "release/doc/latest.md"))
+			if err != nil {
+				t.Error("Could not read through extracted symlink:", err)
+			} else if string(contents) != "# CLI\n" {
+				t.Errorf("Expected symlink to point to CLI.md, but read '%s'", contents)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveRejectsUnsafeEntries(t *testing.T) {
+	t.Parallel()
+
+	data := []struct {
+		name    string
+		entries []testArchiveEntry
+		message string
+	}{
+		{"ParentDir", []testArchiveEntry{{"../evil", 0644, "evil"}}, "outside"},
+		{"NestedParentDir", []testArchiveEntry{{"release/../../evil", 0644, "evil"}}, "outside"},
+		{"AbsolutePath", []testArchiveEntry{{"/tmp/evil", 0644, "evil"}}, "unsafe"},
+		{"Backslash", []testArchiveEntry{{"..\\evil", 0644, "evil"}}, "unsafe"},
+		{"AbsoluteSymlink", []testArchiveEntry{{"link", os.ModeSymlink | 0777, "/etc"}}, "unsafe"},
+		{"EscapingSymlink", []testArchiveEntry{{"release/link", os.ModeSymlink | 0777, "../.."}}, "outside"},
+		{"ThroughSymlink", []testArchiveEntry{
+			{"link", os.ModeSymlink | 0777, "."},
+			{"link/evil", os.ModeSymlink | 0777, "../evil"},
+		}, "inside of symlink"},
+		{"ParentOfSymlink", []testArchiveEntry{
+			{"sub", os.ModeSymlink | 0777, "."},
+			{"x", os.ModeSymlink | 0777, "sub/.."},
+		}, "goes through symlink 'sub'"},
+		{"ParentOfLaterSymlink", []testArchiveEntry{
+			{"x", os.ModeSymlink | 0777, "sub/.."},
+			{"sub", os.ModeSymlink | 0777, "."},
+		}, "goes through symlink 'sub'"},
+		{"Duplicate", []testArchiveEntry{
+			{"file", 0644, "good"},
+			{"file", 0644, "evil"},
+		}, "exists"},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpDir := mustMakeTmpDir(t, "anwork-archive")
+			defer os.RemoveAll(tmpDir)
+			archivePath := filepath.Join(tmpDir, "release.zip")
+			writeTestArchive(t, archivePath, d.entries)
+
+			err := extractArchive(archivePath, filepath.Join(tmpDir, "dest"))
+			if err == nil {
+				t.Fatal("Expected error from extracting unsafe archive")
+			} else if !strings.Contains(err.Error(), d.message) {
+				t.Errorf("Expected error to contain '%s', got '%s'", d.message, err)
+			}
+
+			if fileExists(filepath.Join(tmpDir, "evil")) {
+				t.Error("Unsafe archive wrote outside of the destination directory")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveLimits(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-archive")
+	defer os.RemoveAll(tmpDir)
+	archivePath := filepath.Join(tmpDir, "release.tar.gz")
+	writeTestArchive(t, archivePath, []testArchiveEntry{
+		{"a", 0644, strings.Repeat("a", 100)},
+		{"b", 0644, strings.Repeat("b", 100)},
+	})
+
+	data := []struct {
+		name    string
+		limits  archiveLimits
+		message string
+	}{
+		{"Entries", archiveLimits{maxEntries: 1, maxFileSize: 1000, maxTotalSize: 1000}, "entries"},
+		{"FileSize", archiveLimits{maxEntries: 10, maxFileSize: 50, maxTotalSize: 1000}, "larger than 50 bytes"},
+		{"TotalSize", archiveLimits{maxEntries: 10, maxFileSize: 1000, maxTotalSize: 150}, "larger than 150 bytes"},
+	}
+	for _, d := range data {
+		err := extractArchiveWithLimits(archivePath, filepath.Join(tmpDir, d.name), d.limits)
+		if err == nil {
+			t.Errorf("%s: expected error from extracting archive", d.name)
+		} else if !strings.Contains(err.Error(), d.message) {
+			t.Errorf("%s: expected error to contain '%s', got '%s'", d.name, d.message, err)
+		}
+	}
+
+	if err := extractArchive(archivePath, filepath.Join(tmpDir, "default")); err != nil {
+		t.Error("Expected archive to be extracted with the default limits:", err)
+	}
+}
+
+// Write a zip or tar.gz archive (depending on the extension of the provided path) with the provided
+// entries.
+func writeTestArchive(t *testing.T, archivePath string, entries []testArchiveEntry) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal("Could not create archive:", err)
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(archivePath, ".zip") {
+		zipWriter := zip.NewWriter(file)
+		defer zipWriter.Close()
+		for _, entry := range entries {
+			header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+			header.SetMode(entry.mode)
+			writer, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				t.Fatal("Could not write zip header:", err)
+			}
+			if _, err := writer.Write([]byte(entry.contents)); err != nil {
+				t.Fatal("Could not write zip file:", err)
+			}
+		}
+		return
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: int64(entry.mode.Perm())}
+		switch {
+		case entry.mode.IsDir():
+			header.Typeflag = tar.TypeDir
+		case entry.mode&os.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.contents
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.contents))
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal("Could not write tar header:", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tarWriter.Write([]byte(entry.contents)); err != nil {
+				t.Fatal("Could not write tar file:", err)
+			}
+		}
+	}
+}
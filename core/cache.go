@@ -0,0 +1,430 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This environment variable can hold the path to the directory that releases are unpacked into. See
+// CacheDir.
+const CacheEnv = "ANWORK_CACHE"
+
+// This is the name of the file that marks a cache entry as completely unpacked. It is the last thing
+// written into a cache entry before the entry is renamed into place.
+const cacheCompleteMarker = ".anwork-complete"
+
+// This is the prefix of the temporary directories that archives are unpacked into before they are
+// renamed into place. See unpackIntoCache.
+const cacheTmpPrefix = ".tmp-"
+
+// This is the suffix of the lock file that guards each cache entry. See unpackIntoCache.
+const cacheLockSuffix = ".lock"
+
+// Returns the directory that releases are unpacked into. This is the CacheEnv environment variable
+// if it is set, otherwise it is an anwork_testing directory in the user's cache directory. The
+// cache is shared by every test package (and every process), and it is keyed by the hash of the
+// release archive, so a release is only ever unpacked once.
+func CacheDir() (string, error) {
+	cacheDir := os.Getenv(CacheEnv)
+	if cacheDir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			userCacheDir = os.TempDir()
+		}
+		cacheDir = filepath.Join(userCacheDir, "anwork_testing")
+	}
+
+	if err := os.MkdirAll(cacheDir, os.ModeDir|os.ModePerm); err != nil {
+		return "", errors.New("Anwork cache directory cannot be created: " + err.Error())
+	}
+
+	return filepath.Abs(cacheDir)
+}
+
+// Returns the path to the cache entry for the provided archive hash.
+func makeCacheEntryPath(cacheDir, hash string) string {
+	return filepath.Join(cacheDir, hash)
+}
+
+// Unpack the provided archive into the provided cache directory, unless it has already been
+// unpacked, and return the path to the unpacked archive. This function is safe to call from
+// multiple goroutines and multiple processes at the same time.
+//
+// The cache entry is guarded by a file lock. The archive is unpacked into a temporary directory, a
+// completion marker is written, and then the temporary directory is renamed into place. An entry
+// without a completion marker (e.g., from a process that crashed in the middle of unpacking) is
+// deleted and unpacked again.
+func unpackIntoCache(cacheDir, archivePath, hash string) (string, error) {
+	entryPath := makeCacheEntryPath(cacheDir, hash)
+
+	lock, err := lockFile(entryPath + cacheLockSuffix)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	if _, err := os.Stat(filepath.Join(entryPath, cacheCompleteMarker)); err == nil {
+		return entryPath, touchCacheEntry(entryPath)
+	}
+
+	if err := os.RemoveAll(entryPath); err != nil {
+		return "", errors.New("Incomplete anwork cache entry cannot be deleted: " + err.Error())
+	}
+
+	tmpPath, err := ioutil.TempDir(cacheDir, cacheTmpPrefix+hash+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpPath) // this is a no-op if the rename below succeeds
+
+	if err := extractArchive(archivePath, tmpPath); err != nil {
+		return "", err
+	}
+
+	marker := fmt.Sprintf("%s\n%s\n", archivePath, time.Now().Format(time.RFC3339))
+	markerPath := filepath.Join(tmpPath, cacheCompleteMarker)
+	if err := ioutil.WriteFile(markerPath, []byte(marker), 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmpPath, entryPath); err != nil {
+		return "", err
+	}
+
+	return entryPath, nil
+}
+
+// Mark the provided cache entry as used right now. See CacheEntry.LastUsed.
+func touchCacheEntry(entryPath string) error {
+	now := time.Now()
+	markerPath := filepath.Join(entryPath, cacheCompleteMarker)
+	if _, err := os.Stat(markerPath); err == nil {
+		return os.Chtimes(markerPath, now, now)
+	}
+	return os.Chtimes(entryPath, now, now)
+}
+
+// CacheEntry describes something in the cache directory, i.e., an unpacked release or a local
+// build. See CacheDir.
+type CacheEntry struct {
+	// This is the path to the cache entry.
+	Path string
+
+	// This is the name of the cache entry. For unpacked releases, it is the hash of the archive.
+	Name string
+
+	// This is the path to the archive that the cache entry was unpacked from. It is empty if the
+	// cache entry did not come from an archive (e.g., it is a local build).
+	ArchivePath string
+
+	// This is true iff the cache entry was completely unpacked.
+	Complete bool
+
+	// This is the total size of the files in the cache entry, in bytes.
+	Size int64
+
+	// This is the last time that the cache entry was used by MakeAnwork.
+	LastUsed time.Time
+}
+
+func (entry *CacheEntry) String() string {
+	source := entry.ArchivePath
+	if source == "" {
+		source = "-"
+	}
+	if !entry.Complete {
+		source += " (incomplete)"
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s", entry.Name, entry.Size, entry.LastUsed.Format(time.RFC3339), source)
+}
+
+// Returns every entry in the provided cache directory, least recently used first.
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]CacheEntry, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		entry := CacheEntry{
+			Path:     filepath.Join(cacheDir, info.Name()),
+			Name:     info.Name(),
+			LastUsed: info.ModTime(),
+		}
+
+		markerPath := filepath.Join(entry.Path, cacheCompleteMarker)
+		if marker, err := ioutil.ReadFile(markerPath); err == nil {
+			entry.Complete = true
+			entry.ArchivePath = strings.SplitN(string(marker), "\n", 2)[0]
+			if markerInfo, err := os.Stat(markerPath); err == nil {
+				entry.LastUsed = markerInfo.ModTime()
+			}
+		} else if strings.HasPrefix(entry.Name, "local-") {
+			entry.Complete = true // local builds are renamed into place, so they are always complete
+		}
+
+		err = filepath.Walk(entry.Path, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				entry.Size += info.Size()
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Remove entries from the provided cache directory and return the entries that were removed. First,
+// every entry that has not been used within maxAge is removed. Then, the least recently used entries
+// are removed until the total size of the cache is at most maxSize bytes. A maxAge or maxSize of 0
+// means that there is no limit.
+//
+// The files that ListCache does not report are cleaned up as well: temporary directories that are
+// older than maxAge (these are left behind by processes that crashed while unpacking an archive),
+// and lock files and hash records whose cache entry no longer exists.
+func PruneCache(cacheDir string, maxAge time.Duration, maxSize int64) ([]CacheEntry, error) {
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	for _, entry := range entries {
+		totalSize += entry.Size
+	}
+
+	removed := []CacheEntry{}
+	for _, entry := range entries {
+		tooOld := maxAge > 0 && time.Since(entry.LastUsed) > maxAge
+		tooBig := maxSize > 0 && totalSize > maxSize
+		if !tooOld && !tooBig {
+			continue
+		}
+
+		if err := removeCacheEntry(entry); err != nil {
+			return removed, err
+		}
+		totalSize -= entry.Size
+		removed = append(removed, entry)
+	}
+
+	if err := pruneCacheLeftovers(cacheDir, maxAge); err != nil {
+		return removed, err
+	}
+	if err := pruneHashRecords(cacheDir, maxAge); err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// Remove a cache entry while holding its lock, so that nobody is unpacking it at the same time. The
+// lock file itself is left behind, since somebody else might be waiting on it; pruneCacheLeftovers
+// removes it later.
+func removeCacheEntry(entry CacheEntry) error {
+	lock, err := lockFile(entry.Path + cacheLockSuffix)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	return os.RemoveAll(entry.Path)
+}
+
+// Remove the temporary directories in the provided cache directory that are older than maxAge, and
+// the lock files whose cache entry does not exist. Both are removed while holding the lock of the
+// cache entry that they belong to, so that nobody is unpacking that cache entry at the same time.
+func pruneCacheLeftovers(cacheDir string, maxAge time.Duration) error {
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() && strings.HasPrefix(name, cacheTmpPrefix) {
+			if maxAge == 0 || time.Since(info.ModTime()) <= maxAge {
+				continue
+			}
+
+			// The temporary directory is named cacheTmpPrefix + hash + "-" + some random suffix.
+			hash := strings.TrimPrefix(name, cacheTmpPrefix)
+			if index := strings.LastIndex(hash, "-"); index >= 0 {
+				hash = hash[:index]
+			}
+			entryPath := makeCacheEntryPath(cacheDir, hash)
+			if err := removeWhileLocked(entryPath, filepath.Join(cacheDir, name)); err != nil {
+				return err
+			}
+		} else if !info.IsDir() && strings.HasSuffix(name, cacheLockSuffix) {
+			entryPath := filepath.Join(cacheDir, strings.TrimSuffix(name, cacheLockSuffix))
+			if _, err := os.Stat(entryPath); err == nil {
+				continue
+			}
+			if err := removeWhileLocked(entryPath, entryPath+cacheLockSuffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Remove the provided path while holding the lock of the provided cache entry. If the path is the
+// lock file itself, then it is only removed if the cache entry still does not exist once the lock is
+// held.
+func removeWhileLocked(entryPath, path string) error {
+	lockPath := entryPath + cacheLockSuffix
+	lock, err := lockFile(lockPath)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	if path == lockPath {
+		if _, err := os.Stat(entryPath); err == nil {
+			return nil
+		}
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return os.RemoveAll(path)
+}
+
+// Make sure that the files in the provided cache entry match the files in the archive that it was
+// unpacked from. An error is returned that describes every file that is missing or different.
+func VerifyCacheEntry(entry CacheEntry) error {
+	if !entry.Complete {
+		return fmt.Errorf("Cache entry %s is incomplete", entry.Name)
+	} else if entry.ArchivePath == "" {
+		return fmt.Errorf("Cache entry %s did not come from an archive", entry.Name)
+	}
+
+	problems := []string{}
+	err := walkArchive(entry.ArchivePath, func(archiveEntry *archiveEntry) error {
+		name := archiveEntry.Name
+		entryPath := filepath.Join(entry.Path, filepath.FromSlash(name))
+		mode := archiveEntry.Info.Mode()
+		if mode.IsDir() {
+			return nil
+		} else if mode&os.ModeSymlink != 0 {
+			target, err := os.Readlink(entryPath)
+			if err != nil {
+				problems = append(problems, err.Error())
+			} else if target != archiveEntry.Linkname {
+				problems = append(problems, fmt.Sprintf("%s does not point to %s", name, archiveEntry.Linkname))
+			}
+			return nil
+		}
+
+		expected, err := ioutil.ReadAll(archiveEntry.Reader)
+		if err != nil {
+			return err
+		}
+
+		actual, err := ioutil.ReadFile(entryPath)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if !bytes.Equal(expected, actual) {
+			problems = append(problems, fmt.Sprintf("%s does not match the archive", name))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Cache entry %s does not match %s:\n  %s",
+			entry.Name, entry.ArchivePath, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// This is the regular expression that matches the names of the context directories that
+// MakeAnwork creates (see makeContextDir), i.e., contextDirPrefix, the (optional) test name, and the
+// random number that os.MkdirTemp adds, as well as the tmp_XXXX ones that older versions of
+// MakeAnwork created in the test package directories.
+var contextDirRegex = regexp.MustCompile(
+	`^(tmp_[0-9a-f]{4}|` + regexp.QuoteMeta(contextDirPrefix) + `([A-Za-z0-9_.-]+-)?[0-9]{1,10})$`)
+
+// Remove the context directories that tests left behind (e.g., because they crashed before calling
+// Anwork.Close) in the provided root directory (e.g., ContextRoot). If subdirs is true, then the
+// immediate subdirectories of the root (e.g., the test package directories, for older context
+// directories) are searched too. Cache entries (i.e., directories with a cacheCompleteMarker in
+// them) are never searched. Only context directories that have not been modified within maxAge are
+// removed, since a newer one might still be in use by a running test. The paths of the removed
+// directories are returned.
+func RemoveOrphanedContexts(root string, maxAge time.Duration, subdirs bool) ([]string, error) {
+	if isCacheEntry(root) {
+		return nil, fmt.Errorf("Will not remove context directories from cache entry %s", root)
+	}
+
+	dirs := []string{root}
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		dir := filepath.Join(root, info.Name())
+		if subdirs && info.IsDir() && !contextDirRegex.MatchString(info.Name()) && !isCacheEntry(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	removed := []string{}
+	for _, dir := range dirs {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return removed, err
+		}
+
+		for _, info := range infos {
+			if !info.IsDir() || !contextDirRegex.MatchString(info.Name()) {
+				continue
+			} else if time.Since(info.ModTime()) < maxAge {
+				continue
+			}
+
+			path := filepath.Join(dir, info.Name())
+			if err := os.RemoveAll(path); err != nil {
+				return removed, err
+			}
+			removed = append(removed, path)
+		}
+	}
+
+	return removed, nil
+}
+
+// Returns true iff the provided directory is a complete cache entry, i.e., it has a
+// cacheCompleteMarker in it.
+func isCacheEntry(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, cacheCompleteMarker))
+	return err == nil
+}
@@ -0,0 +1,439 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// These environment variables are used to turn a test executable into a helper process that
+// unpacks an archive into a cache. See TestCacheHelperProcess.
+const (
+	helperCacheDirEnv = "ANWORK_TESTING_HELPER_CACHE_DIR"
+	helperArchiveEnv  = "ANWORK_TESTING_HELPER_ARCHIVE"
+)
+
+// This map mimics the file tree in the test.zip file.
+var testZipFileTree = map[string][]string{
+	"":      []string{"file-1", "file-2"},
+	"dir-a": []string{"file-a-1", "file-a-2"},
+	"dir-b": []string{"file-b-1"},
+}
+
+func TestCacheParallelUnpack(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	const unpackersCount = 8
+	pathChan := make(chan string, unpackersCount)
+	for i := 0; i < cap(pathChan); i++ {
+		go func(i int) {
+			entryPath, err := unpackIntoCache(cacheDir, testZipPath, "test")
+			if err != nil {
+				t.Errorf("Failed to unpack archive in %dth unpacker: %s", i, err)
+			}
+			pathChan <- entryPath
+		}(i)
+	}
+
+	for i := 0; i < cap(pathChan); i++ {
+		if entryPath := <-pathChan; entryPath != makeCacheEntryPath(cacheDir, "test") {
+			t.Errorf("Unexpected cache entry path: %s", entryPath)
+		}
+	}
+	checkCache(t, cacheDir, "test")
+}
+
+func TestCacheIncompleteEntry(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	// This looks like an entry from a process that crashed in the middle of unpacking.
+	entryPath := makeCacheEntryPath(cacheDir, "test")
+	if err := os.MkdirAll(path.Join(entryPath, "test"), os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create incomplete cache entry:", err)
+	}
+	junkPath := path.Join(entryPath, "test", "junk")
+	if err := ioutil.WriteFile(junkPath, []byte("junk"), 0644); err != nil {
+		t.Fatal("Could not write junk file:", err)
+	}
+
+	if _, err := unpackIntoCache(cacheDir, testZipPath, "test"); err != nil {
+		t.Fatal("Failed to unpack archive:", err)
+	}
+	if fileExists(junkPath) {
+		t.Error("Expected incomplete cache entry to be replaced")
+	}
+	checkCache(t, cacheDir, "test")
+}
+
+func TestCacheMultipleProcesses(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+	archivePath, err := filepath.Abs(testZipPath)
+	if err != nil {
+		t.Fatal("Could not get absolute archive path:", err)
+	}
+
+	const processesCount = 4
+	cmds := make([]*exec.Cmd, processesCount)
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=TestCacheHelperProcess")
+		cmds[i].Env = append(os.Environ(), helperCacheDirEnv+"="+cacheDir, helperArchiveEnv+"="+archivePath)
+		if err := cmds[i].Start(); err != nil {
+			t.Fatalf("Could not start %dth helper process: %s", i, err)
+		}
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("%dth helper process failed: %s", i, err)
+		}
+	}
+	checkCache(t, cacheDir, "test")
+}
+
+// This is not a real test. It is run in a separate process by TestCacheMultipleProcesses.
+func TestCacheHelperProcess(t *testing.T) {
+	cacheDir := os.Getenv(helperCacheDirEnv)
+	if cacheDir == "" {
+		t.Skip("Skipping TestCacheHelperProcess because it is only a helper process")
+	}
+
+	if _, err := unpackIntoCache(cacheDir, os.Getenv(helperArchiveEnv), "test"); err != nil {
+		t.Fatal("Failed to unpack archive:", err)
+	}
+}
+
+func TestListAndPruneCache(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	for _, hash := range []string{"old", "new"} {
+		if _, err := unpackIntoCache(cacheDir, testZipPath, hash); err != nil {
+			t.Fatal("Failed to unpack archive:", err)
+		}
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	markerPath := path.Join(makeCacheEntryPath(cacheDir, "old"), cacheCompleteMarker)
+	if err := os.Chtimes(markerPath, oldTime, oldTime); err != nil {
+		t.Fatal("Could not change time of cache entry:", err)
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		t.Fatal("Failed to list cache:", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "old" || entries[1].Name != "new" {
+		t.Fatalf("Expected old and new cache entries, got %v", entries)
+	}
+	for _, entry := range entries {
+		t.Logf("Listed cache entry %s", entry.String())
+		if !entry.Complete || entry.Size == 0 || !strings.HasSuffix(entry.ArchivePath, testZipPath) {
+			t.Errorf("Unexpected cache entry: %#v", entry)
+		}
+	}
+
+	// Prune by age first, then by size.
+	removed, err := PruneCache(cacheDir, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	} else if len(removed) != 1 || removed[0].Name != "old" {
+		t.Errorf("Expected old cache entry to be pruned, got %v", removed)
+	}
+	removed, err = PruneCache(cacheDir, 0, 1)
+	if err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	} else if len(removed) != 1 || removed[0].Name != "new" {
+		t.Errorf("Expected new cache entry to be pruned, got %v", removed)
+	}
+
+	if entries, err := ListCache(cacheDir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected empty cache, got %v (error: %v)", entries, err)
+	}
+}
+
+func TestPruneCacheTmpDirs(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	// These look like the temporary directories of processes that crashed while unpacking.
+	oldTmpPath := mustMakeCacheTmpDir(t, cacheDir, "old")
+	newTmpPath := mustMakeCacheTmpDir(t, cacheDir, "new")
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(oldTmpPath, oldTime, oldTime); err != nil {
+		t.Fatal("Could not change time of temporary directory:", err)
+	}
+
+	if _, err := PruneCache(cacheDir, 0, 0); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	} else if !fileExists(oldTmpPath) || !fileExists(newTmpPath) {
+		t.Error("Expected no temporary directories to be pruned without a maxAge")
+	}
+
+	if _, err := PruneCache(cacheDir, 24*time.Hour, 0); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	}
+	if fileExists(oldTmpPath) {
+		t.Errorf("Expected old temporary directory %s to be pruned", oldTmpPath)
+	}
+	if !fileExists(newTmpPath) {
+		t.Errorf("Expected new temporary directory %s to be kept", newTmpPath)
+	}
+}
+
+func TestPruneCacheLockFiles(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	for _, hash := range []string{"a", "b"} {
+		if _, err := unpackIntoCache(cacheDir, testZipPath, hash); err != nil {
+			t.Fatal("Failed to unpack archive:", err)
+		}
+	}
+	orphanLockPath := makeCacheEntryPath(cacheDir, "c") + cacheLockSuffix
+	if err := ioutil.WriteFile(orphanLockPath, []byte{}, 0644); err != nil {
+		t.Fatal("Could not write lock file:", err)
+	}
+
+	// Pruning one entry should take its lock file (and the orphaned one) with it.
+	if _, err := PruneCache(cacheDir, 0, 1); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	}
+	if entries, err := ListCache(cacheDir); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected empty cache, got %v (error: %v)", entries, err)
+	}
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal("Could not read cache directory:", err)
+	}
+	for _, info := range infos {
+		t.Errorf("Unexpected file left in cache directory: %s", info.Name())
+	}
+
+	// The lock should still work after its file has been removed.
+	checkUnpackIntoCache(t, cacheDir, "a")
+	if _, err := PruneCache(cacheDir, 0, 0); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	}
+	checkCache(t, cacheDir, "a")
+	if !fileExists(makeCacheEntryPath(cacheDir, "a") + cacheLockSuffix) {
+		t.Error("Expected lock file of existing cache entry to be kept")
+	}
+}
+
+func TestPruneCacheHashRecords(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	key, err := makeFileHashKey(testZipPath)
+	if err != nil {
+		t.Fatal("Could not make hash key:", err)
+	}
+	hash, err := hashFile(testZipPath)
+	if err != nil {
+		t.Fatal("Failed to hash archive:", err)
+	}
+	checkUnpackIntoCache(t, cacheDir, hash)
+
+	// The hash of the archive might already be remembered by this process, so write the record here
+	// rather than relying on hashFileCached to do it.
+	recordPath := makeHashRecordPath(cacheDir, key)
+	if err := writeHashRecord(recordPath, hash); err != nil {
+		t.Fatal("Could not write hash record:", err)
+	}
+	tmpRecordPath := filepath.Join(cacheDir, hashCacheDir, cacheTmpPrefix+"crashed")
+	if err := ioutil.WriteFile(tmpRecordPath, []byte(hash[:10]), 0644); err != nil {
+		t.Fatal("Could not write temporary hash record:", err)
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(tmpRecordPath, oldTime, oldTime); err != nil {
+		t.Fatal("Could not change time of temporary hash record:", err)
+	}
+
+	if _, err := PruneCache(cacheDir, 24*time.Hour, 0); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	}
+	if !fileExists(recordPath) {
+		t.Error("Expected hash record of existing cache entry to be kept")
+	}
+	if fileExists(tmpRecordPath) {
+		t.Error("Expected old temporary hash record to be pruned")
+	}
+
+	if removed, err := PruneCache(cacheDir, 0, 1); err != nil {
+		t.Fatal("Failed to prune cache:", err)
+	} else if len(removed) != 1 || removed[0].Name != hash {
+		t.Fatalf("Expected cache entry %s to be pruned, got %v", hash, removed)
+	}
+	if fileExists(recordPath) {
+		t.Error("Expected hash record of pruned cache entry to be removed")
+	}
+}
+
+func checkUnpackIntoCache(t *testing.T, cacheDir, hash string) {
+	if _, err := unpackIntoCache(cacheDir, testZipPath, hash); err != nil {
+		t.Fatal("Failed to unpack archive:", err)
+	}
+}
+
+// Returns a temporary directory in the provided cache directory that looks like the one that
+// unpackIntoCache uses for the provided hash.
+func mustMakeCacheTmpDir(t *testing.T, cacheDir, hash string) string {
+	tmpPath, err := ioutil.TempDir(cacheDir, cacheTmpPrefix+hash+"-")
+	if err != nil {
+		t.Fatal("Could not create temporary directory:", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpPath, "file"), []byte("partial"), 0644); err != nil {
+		t.Fatal("Could not write into temporary directory:", err)
+	}
+	return tmpPath
+}
+
+func TestVerifyCacheEntry(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := mustMakeTmpDir(t, "anwork-cache")
+	defer os.RemoveAll(cacheDir)
+
+	entryPath, err := unpackIntoCache(cacheDir, testZipPath, "test")
+	if err != nil {
+		t.Fatal("Failed to unpack archive:", err)
+	}
+	entries, err := ListCache(cacheDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one cache entry, got %v (error: %v)", entries, err)
+	}
+
+	if err := VerifyCacheEntry(entries[0]); err != nil {
+		t.Error("Expected cache entry to verify:", err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(entryPath, "test", "file-1"), []byte("oops"), 0644); err != nil {
+		t.Fatal("Could not corrupt cache entry:", err)
+	}
+	if err := os.Remove(path.Join(entryPath, "test", "dir-a", "file-a-2")); err != nil {
+		t.Fatal("Could not corrupt cache entry:", err)
+	}
+	err = VerifyCacheEntry(entries[0])
+	if err == nil {
+		t.Fatal("Expected corrupt cache entry to fail verification")
+	}
+	t.Logf("Got verification error: %s", err)
+	for _, name := range []string{"file-1", "file-a-2"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected verification error to mention %s", name)
+		}
+	}
+}
+
+func TestRemoveOrphanedContexts(t *testing.T) {
+	t.Parallel()
+
+	root := mustMakeTmpDir(t, "anwork-root")
+	defer os.RemoveAll(root)
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	dirs := map[string]bool{ // path -> should be removed
+		"tmp_abcd":                         true,
+		"anwork-context-TestCreate-123456": true,
+		"anwork-context-98765":             true,
+		"anwork-context-release":           false,
+		"anwork-2":                         false, // an unpacked release, not a context directory
+		"anwork-TestCreate-123456":         false,
+		"v1/tmp_0123":                      true,
+		"v1/tmp_4567":                      false, // too new
+		"v1/not_a_ctx":                     false,
+		"v1/tmp_zzzz":                      false,
+		"0123abcd/anwork-context-123":      false, // in a cache entry
+		"0123abcd/anwork-2":                false,
+	}
+	for dir := range dirs {
+		dirPath := path.Join(root, dir)
+		if err := os.MkdirAll(dirPath, os.ModeDir|os.ModePerm); err != nil {
+			t.Fatal("Could not create directory:", err)
+		}
+		if dir != "v1/tmp_4567" {
+			if err := os.Chtimes(dirPath, oldTime, oldTime); err != nil {
+				t.Fatal("Could not change time of directory:", err)
+			}
+		}
+	}
+	markerPath := path.Join(root, "0123abcd", cacheCompleteMarker)
+	if err := ioutil.WriteFile(markerPath, []byte("test.zip\n"), 0644); err != nil {
+		t.Fatal("Could not write completion marker:", err)
+	}
+
+	// Subdirectories are only searched when asked for.
+	checkRemoveOrphanedContexts(t, root, false, dirs)
+	checkRemoveOrphanedContexts(t, root, true, dirs)
+
+	if _, err := RemoveOrphanedContexts(path.Join(root, "0123abcd"), 24*time.Hour, false); err == nil {
+		t.Error("Expected error from removing orphaned contexts in a cache entry")
+	}
+}
+
+// Remove the orphaned contexts in the provided root directory, and make sure that every one of the
+// provided directories was removed iff it should have been. Directories in subdirectories of the
+// root should only be removed if subdirs is true.
+func checkRemoveOrphanedContexts(t *testing.T, root string, subdirs bool, dirs map[string]bool) {
+	removed, err := RemoveOrphanedContexts(root, 24*time.Hour, subdirs)
+	if err != nil {
+		t.Fatal("Failed to remove orphaned contexts:", err)
+	}
+	t.Logf("Removed orphaned contexts (subdirs: %t): %s", subdirs, removed)
+	for dir, shouldBeRemoved := range dirs {
+		if !subdirs && strings.Contains(dir, "/") {
+			shouldBeRemoved = false
+		}
+		if exists := fileExists(path.Join(root, dir)); exists == shouldBeRemoved {
+			t.Errorf("Expected %s to be removed: %t, but it exists: %t", dir, shouldBeRemoved, exists)
+		}
+	}
+}
+
+// Make sure that the provided cache directory has exactly one complete entry for the provided hash,
+// and nothing else except for its lock file.
+func checkCache(t *testing.T, cacheDir, hash string) {
+	entryPath := makeCacheEntryPath(cacheDir, hash)
+	checkFileTree(t, path.Join(entryPath, "test"), testZipFileTree)
+	if !fileExists(path.Join(entryPath, cacheCompleteMarker)) {
+		t.Errorf("Expected cache entry %s to have a completion marker", entryPath)
+	}
+
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal("Could not read cache directory:", err)
+	}
+	for _, info := range infos {
+		if info.Name() != hash && info.Name() != hash+".lock" {
+			t.Errorf("Unexpected file left in cache directory: %s", info.Name())
+		}
+	}
+}
+
+func mustMakeTmpDir(t *testing.T, prefix string) string {
+	tmpDirPath, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	return tmpDirPath
+}
@@ -0,0 +1,211 @@
+package context
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// This is the priority that anwork gives a task when it is created.
+const DefaultPriority = 10
+
+// Builder makes a State from Go code, e.g., to generate a fixture (see Generate). Every method
+// records the same journal entry that anwork would for the equivalent command, at the provided time,
+// so a built context looks just like one that anwork wrote. Methods can be chained; the first
+// error (e.g., a task that does not exist) is returned from Build.
+//
+//	state, err := context.NewBuilder().
+//	  Create("task-a", start).
+//	  SetState("task-a", context.Running, start.Add(time.Minute)).
+//	  Build()
+type Builder struct {
+	state *State
+
+	// This is the ID of the next task that is created. Like in anwork, IDs are not reused after a
+	// task is deleted.
+	nextID int32
+
+	err error
+}
+
+// Make a Builder for the empty State.
+func NewBuilder() *Builder {
+	return &Builder{state: &State{Tasks: []*Task{}, Journal: []*JournalEntry{}}}
+}
+
+// Create a task with the provided name at the provided time, like "anwork create".
+func (builder *Builder) Create(name string, at time.Time) *Builder {
+	if builder.err != nil {
+		return builder
+	} else if builder.state.Task(name) != nil {
+		builder.err = fmt.Errorf("Task %s already exists", name)
+		return builder
+	}
+
+	task := &Task{Name: name, ID: builder.nextID, Created: at, Priority: DefaultPriority, State: Waiting}
+	builder.nextID++
+	builder.state.Tasks = append(builder.state.Tasks, task)
+	return builder.Entry(&JournalEntry{
+		Title:  "Created task " + name,
+		Type:   CreateEntry,
+		Date:   at,
+		TaskID: task.ID,
+	})
+}
+
+// Delete the task with the provided name at the provided time, like "anwork delete".
+func (builder *Builder) Delete(name string, at time.Time) *Builder {
+	task := builder.task(name)
+	if task == nil {
+		return builder
+	}
+
+	for i := range builder.state.Tasks {
+		if builder.state.Tasks[i] == task {
+			builder.state.Tasks = append(builder.state.Tasks[:i], builder.state.Tasks[i+1:]...)
+			break
+		}
+	}
+	return builder.Entry(&JournalEntry{
+		Title:  "Deleted task " + name,
+		Type:   DeleteEntry,
+		Date:   at,
+		TaskID: task.ID,
+	})
+}
+
+// Set the state of the task with the provided name at the provided time, like "anwork set-running".
+func (builder *Builder) SetState(name string, state TaskState, at time.Time) *Builder {
+	task := builder.task(name)
+	if task == nil {
+		return builder
+	}
+
+	title := fmt.Sprintf("Set state on task %s from %s to %s", name, stateTitle(task.State),
+		stateTitle(state))
+	task.State = state
+	return builder.Entry(&JournalEntry{Title: title, Type: SetStateEntry, Date: at, TaskID: task.ID})
+}
+
+// Set the priority of the task with the provided name at the provided time, like
+// "anwork set-priority".
+func (builder *Builder) SetPriority(name string, priority int32, at time.Time) *Builder {
+	task := builder.task(name)
+	if task == nil {
+		return builder
+	}
+
+	title := fmt.Sprintf("Set priority on task %s from %d to %d", name, task.Priority, priority)
+	task.Priority = priority
+	return builder.Entry(&JournalEntry{Title: title, Type: SetPriorityEntry, Date: at, TaskID: task.ID})
+}
+
+// Add a note to the task with the provided name at the provided time, like "anwork note".
+func (builder *Builder) Note(name, note string, at time.Time) *Builder {
+	task := builder.task(name)
+	if task == nil {
+		return builder
+	}
+
+	return builder.Entry(&JournalEntry{
+		Title:  fmt.Sprintf("Note added to task %s: %s", name, note),
+		Type:   NoteEntry,
+		Date:   at,
+		TaskID: task.ID,
+	})
+}
+
+// Add the provided entry to the end of the journal as is. This is for contexts that anwork itself
+// would not write, e.g., ones with entries for tasks that never existed.
+func (builder *Builder) Entry(entry *JournalEntry) *Builder {
+	if builder.err == nil {
+		builder.state.Journal = append(builder.state.Journal, entry)
+	}
+	return builder
+}
+
+// Returns the built State, or the first error that happened while building it.
+func (builder *Builder) Build() (*State, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+	return builder.state, nil
+}
+
+// Returns the task with the provided name, or records an error and returns nil if there is no such
+// task (or if an error has already been recorded).
+func (builder *Builder) task(name string) *Task {
+	if builder.err != nil {
+		return nil
+	}
+	task := builder.state.Task(name)
+	if task == nil {
+		builder.err = fmt.Errorf("Task %s does not exist", name)
+	}
+	return task
+}
+
+// Returns the state like anwork writes it in a journal entry title, e.g., "Waiting".
+func stateTitle(state TaskState) string {
+	switch state {
+	case Waiting:
+		return "Waiting"
+	case Blocked:
+		return "Blocked"
+	case Running:
+		return "Running"
+	case Finished:
+		return "Finished"
+	default:
+		return state.String()
+	}
+}
+
+// Generate is the main function of a fixture generator, i.e., a program in a data directory that is
+// run by "go generate" (see v2/data/generate.go). It writes each of the provided fixtures (which are
+// keyed by file name) into the directory passed via -o. With -check, it instead exits with a
+// non-zero status if any fixture in the directory is not what would be written.
+func Generate(fixtures map[string]*Builder) {
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	dir := flags.String("o", ".", "Write the fixtures into this directory")
+	check := flags.Bool("check", false, "Only check that the fixtures are up to date")
+	flags.Parse(os.Args[1:])
+
+	if err := generate(fixtures, *dir, *check); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func generate(fixtures map[string]*Builder, dir string, check bool) error {
+	names := make([]string, 0, len(fixtures))
+	for name := range fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		state, err := fixtures[name].Build()
+		if err != nil {
+			return fmt.Errorf("Cannot build fixture %s: %s", name, err)
+		}
+
+		path := filepath.Join(dir, name)
+		if check {
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			} else if !bytes.Equal(contents, Encode(state)) {
+				return fmt.Errorf("Fixture %s is out of date; run go generate", path)
+			}
+		} else if err := WriteFile(path, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
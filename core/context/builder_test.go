@@ -0,0 +1,99 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1516060787, 0)
+	state, err := NewBuilder().
+		Create("task-a", start).
+		Create("task-b", start.Add(time.Second)).
+		SetPriority("task-b", 5, start.Add(2*time.Second)).
+		Note("task-a", "hello", start.Add(3*time.Second)).
+		SetState("task-a", Running, start.Add(4*time.Second)).
+		Delete("task-b", start.Add(5*time.Second)).
+		Create("task-c", start.Add(6*time.Second)).
+		Build()
+	if err != nil {
+		t.Fatal("Failed to build context:", err)
+	}
+
+	if len(state.Tasks) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(state.Tasks))
+	}
+	if a := state.Tasks[0]; a.Name != "task-a" || a.ID != 0 || a.State != Running || a.Priority != DefaultPriority {
+		t.Errorf("Unexpected task-a %+v", *a)
+	}
+	if c := state.Tasks[1]; c.Name != "task-c" || c.ID != 2 || !c.Created.Equal(start.Add(6*time.Second)) {
+		t.Errorf("Expected task-c to have ID 2 even though task-b was deleted, got %+v", *c)
+	}
+
+	expectedTitles := []string{
+		"Created task task-a",
+		"Created task task-b",
+		"Set priority on task task-b from 10 to 5",
+		"Note added to task task-a: hello",
+		"Set state on task task-a from Waiting to Running",
+		"Deleted task task-b",
+		"Created task task-c",
+	}
+	if len(state.Journal) != len(expectedTitles) {
+		t.Fatalf("Expected %d journal entries, got %d", len(expectedTitles), len(state.Journal))
+	}
+	for i, entry := range state.Journal {
+		if entry.Title != expectedTitles[i] || !entry.Date.Equal(start.Add(time.Duration(i)*time.Second)) {
+			t.Errorf("Expected journal entry %d to be '%s', got %+v", i, expectedTitles[i], *entry)
+		}
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	builders := map[string]*Builder{
+		"duplicate": NewBuilder().Create("task-a", now).Create("task-a", now),
+		"missing":   NewBuilder().SetState("task-a", Running, now),
+		"deleted":   NewBuilder().Create("task-a", now).Delete("task-a", now).Note("task-a", "hi", now),
+	}
+	for name, builder := range builders {
+		if _, err := builder.Build(); err == nil {
+			t.Errorf("Expected an error building the %s context", name)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "anwork-generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := map[string]*Builder{"fixture": NewBuilder().Create("task-a", time.Unix(1516060787, 0))}
+	if err := generate(fixtures, dir, true); err == nil {
+		t.Error("Expected check to fail before the fixture is generated")
+	}
+	if err := generate(fixtures, dir, false); err != nil {
+		t.Fatal("Failed to generate fixtures:", err)
+	}
+	if err := generate(fixtures, dir, true); err != nil {
+		t.Error("Expected check to pass after the fixture is generated:", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "fixture"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(fixtures, dir, true); err == nil {
+		t.Error("Expected check to fail after the fixture is changed")
+	}
+}
@@ -0,0 +1,250 @@
+// Package context decodes the persistence context files that anwork writes (e.g.,
+// v2/data/default-context), so that tests can make assertions about the state that anwork actually
+// persisted instead of about how it is formatted by "anwork show" and "anwork journal".
+//
+// A context file is a protobuf message that looks like this.
+//
+//	message Manager {
+//	  repeated Task tasks = 1;
+//	  Journal journal = 2;
+//	}
+//	message Task {
+//	  string name = 1;
+//	  int32 id = 2;
+//	  int64 startDate = 4;
+//	  int32 priority = 5;
+//	  State state = 6;
+//	}
+//	message Journal {
+//	  repeated Event events = 1;
+//	}
+//	message Event {
+//	  string title = 1;
+//	  Type type = 2;
+//	  int64 date = 3;
+//	  int32 taskId = 4;
+//	}
+//
+// Fields that this package does not know about are kept (see State.Unknown, etc.), so that nothing
+// is lost from a context that was written by a newer anwork.
+//
+// This package is usually imported with a name other than context (e.g., anworkcontext), so that it
+// does not collide with the standard library context package.
+package context
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TaskState is the state of a Task.
+type TaskState int32
+
+const (
+	Waiting TaskState = iota
+	Blocked
+	Running
+	Finished
+)
+
+// Returns the state like anwork prints it, e.g., "WAITING".
+func (state TaskState) String() string {
+	switch state {
+	case Waiting:
+		return "WAITING"
+	case Blocked:
+		return "BLOCKED"
+	case Running:
+		return "RUNNING"
+	case Finished:
+		return "FINISHED"
+	default:
+		return fmt.Sprintf("TaskState(%d)", int32(state))
+	}
+}
+
+// This is part of the encoding.TextMarshaler interface, so that a TaskState is written to JSON as
+// its name. A state that anwork does not know about is written as its number.
+func (state TaskState) MarshalText() ([]byte, error) {
+	return marshalEnum(state.String(), int32(state), "TaskState")
+}
+
+// This is part of the encoding.TextUnmarshaler interface. See MarshalText.
+func (state *TaskState) UnmarshalText(text []byte) error {
+	value, err := unmarshalEnum(text, int32(Waiting), int32(Finished), func(value int32) string {
+		return TaskState(value).String()
+	})
+	*state = TaskState(value)
+	return err
+}
+
+// EntryType is the kind of thing that a JournalEntry records.
+type EntryType int32
+
+const (
+	CreateEntry EntryType = iota
+	DeleteEntry
+	SetStateEntry
+	NoteEntry
+	SetPriorityEntry
+)
+
+func (entryType EntryType) String() string {
+	switch entryType {
+	case CreateEntry:
+		return "create"
+	case DeleteEntry:
+		return "delete"
+	case SetStateEntry:
+		return "set state"
+	case NoteEntry:
+		return "note"
+	case SetPriorityEntry:
+		return "set priority"
+	default:
+		return fmt.Sprintf("EntryType(%d)", int32(entryType))
+	}
+}
+
+// This is part of the encoding.TextMarshaler interface, so that an EntryType is written to JSON as
+// its name, e.g., "set state". An entry type that anwork does not know about is written as its
+// number.
+func (entryType EntryType) MarshalText() ([]byte, error) {
+	return marshalEnum(entryType.String(), int32(entryType), "EntryType")
+}
+
+// This is part of the encoding.TextUnmarshaler interface. See MarshalText.
+func (entryType *EntryType) UnmarshalText(text []byte) error {
+	value, err := unmarshalEnum(text, int32(CreateEntry), int32(SetPriorityEntry), func(value int32) string {
+		return EntryType(value).String()
+	})
+	*entryType = EntryType(value)
+	return err
+}
+
+// Returns the provided name of an enum value, or its number if the name is the fallback name that
+// String returns for unknown values (e.g., "TaskState(7)").
+func marshalEnum(name string, value int32, typeName string) ([]byte, error) {
+	if name == fmt.Sprintf("%s(%d)", typeName, value) {
+		return []byte(strconv.Itoa(int(value))), nil
+	}
+	return []byte(name), nil
+}
+
+// Returns the enum value between min and max (inclusive) whose name is the provided text, or the
+// number in the provided text.
+func unmarshalEnum(text []byte, min, max int32, name func(int32) string) (int32, error) {
+	for value := min; value <= max; value++ {
+		if name(value) == string(text) {
+			return value, nil
+		}
+	}
+	value, err := strconv.ParseInt(string(text), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown value '%s'", text)
+	}
+	return int32(value), nil
+}
+
+// Task is a task in a context.
+type Task struct {
+	Name     string    `json:"name"`
+	ID       int32     `json:"id"`
+	Created  time.Time `json:"created"`
+	Priority int32     `json:"priority"`
+	State    TaskState `json:"state"`
+
+	// These are the encoded fields of the task that this package does not know about.
+	Unknown []byte `json:"unknown,omitempty"`
+}
+
+// JournalEntry is an entry in the journal of a context, e.g., "Created task task-a".
+type JournalEntry struct {
+	Title  string    `json:"title"`
+	Type   EntryType `json:"type"`
+	Date   time.Time `json:"date"`
+	TaskID int32     `json:"taskId"`
+
+	// These are the encoded fields of the entry that this package does not know about.
+	Unknown []byte `json:"unknown,omitempty"`
+}
+
+// State is everything in a context: its tasks, in the order that anwork stores them, and its
+// journal, oldest entry first.
+//
+// A State can be converted to and from JSON with encoding/json, e.g., to make a context readable in a
+// code review (see cmd/anworkjson). States and journal entry types are written as their names, times
+// are written in RFC 3339 format, and unknown fields are written in base64, so nothing is lost.
+type State struct {
+	Tasks   []*Task         `json:"tasks"`
+	Journal []*JournalEntry `json:"journal"`
+
+	// These are the encoded fields of the context (and of its journal) that this package does not
+	// know about.
+	Unknown        []byte `json:"unknown,omitempty"`
+	JournalUnknown []byte `json:"journalUnknown,omitempty"`
+}
+
+// Read the context file at the provided path. A context file that does not exist is the empty
+// State, just like it is for anwork.
+func ReadFile(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decode context %s: %s", path, err)
+	}
+	return state, nil
+}
+
+// Returns the task with the provided name, or nil if there is no such task.
+func (state *State) Task(name string) *Task {
+	for _, task := range state.Tasks {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// Returns the tasks that are in the provided state, in the order that anwork stores them.
+func (state *State) TasksIn(taskState TaskState) []*Task {
+	tasks := []*Task{}
+	for _, task := range state.Tasks {
+		if task.State == taskState {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// Returns the journal entries for the task with the provided ID, oldest entry first.
+func (state *State) JournalFor(taskID int32) []*JournalEntry {
+	entries := []*JournalEntry{}
+	for _, entry := range state.Journal {
+		if entry.TaskID == taskID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Move every time in this state (i.e., when each task was created, and the date of each journal
+// entry) by the provided duration. A negative duration moves them into the past, which makes it look
+// like that much time has passed since they happened.
+func (state *State) Shift(d time.Duration) {
+	for _, task := range state.Tasks {
+		task.Created = task.Created.Add(d)
+	}
+	for _, entry := range state.Journal {
+		entry.Date = entry.Date.Add(d)
+	}
+}
@@ -0,0 +1,146 @@
+package context
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const defaultContextPath = "../../v2/data/default-context"
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	state, err := ReadFile(defaultContextPath)
+	if err != nil {
+		t.Fatal("Failed to read context:", err)
+	}
+
+	expectedTasks := []Task{
+		{Name: "task-a", ID: 0, Created: time.Unix(1516060787, 0), Priority: 10, State: Finished},
+		{Name: "task-b", ID: 1, Created: time.Unix(1516060790, 0), Priority: 10, State: Blocked},
+		{Name: "task-c", ID: 2, Created: time.Unix(1516060792, 0), Priority: 10, State: Running},
+	}
+	if len(state.Tasks) != len(expectedTasks) {
+		t.Fatalf("Expected %d tasks, got %d", len(expectedTasks), len(state.Tasks))
+	}
+	for i, expected := range expectedTasks {
+		task := state.Tasks[i]
+		if task.Name != expected.Name || task.ID != expected.ID || !task.Created.Equal(expected.Created) ||
+			task.Priority != expected.Priority || task.State != expected.State || task.Unknown != nil {
+			t.Errorf("Expected task %d to be %+v, got %+v", i, expected, *task)
+		}
+	}
+
+	if len(state.Journal) != 7 {
+		t.Fatalf("Expected 7 journal entries, got %d", len(state.Journal))
+	}
+	last := state.Journal[6]
+	if last.Title != "Set state on task task-c from Waiting to Running" || last.Type != SetStateEntry ||
+		last.TaskID != 2 || !last.Date.Equal(time.Unix(1516060812, 0)) {
+		t.Errorf("Unexpected last journal entry %+v", *last)
+	}
+
+	if task := state.Task("task-b"); task == nil || task.ID != 1 {
+		t.Errorf("Expected to find task-b, got %+v", task)
+	}
+	if task := state.Task("task-d"); task != nil {
+		t.Errorf("Expected not to find task-d, got %+v", task)
+	}
+	if tasks := state.TasksIn(Running); len(tasks) != 1 || tasks[0].Name != "task-c" {
+		t.Errorf("Expected task-c to be the only running task, got %v", tasks)
+	}
+	if entries := state.JournalFor(0); len(entries) != 3 || entries[0].Type != CreateEntry {
+		t.Errorf("Expected 3 journal entries for task-a, starting with its creation, got %v", entries)
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	t.Parallel()
+
+	state, err := ReadFile(filepath.Join(os.TempDir(), "anwork-context-that-does-not-exist"))
+	if err != nil {
+		t.Fatal("Failed to read missing context:", err)
+	}
+	if len(state.Tasks) != 0 || len(state.Journal) != 0 {
+		t.Errorf("Expected empty state, got %+v", state)
+	}
+}
+
+func TestDecodeUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	// A task (field 1) with a name, an unknown varint field 7, and an unknown string field 8, then an
+	// unknown fixed32 field 3 in the context itself.
+	data := []byte{
+		0x0a, 0x0c,
+		0x0a, 0x01, 'a',
+		0x38, 0x96, 0x01,
+		0x42, 0x04, 'n', 'e', 'w', '!',
+		0x1d, 0x01, 0x02, 0x03, 0x04,
+	}
+	state, err := Decode(data)
+	if err != nil {
+		t.Fatal("Failed to decode context:", err)
+	}
+	if len(state.Tasks) != 1 || state.Tasks[0].Name != "a" {
+		t.Fatalf("Expected task a, got %+v", state.Tasks)
+	}
+	if expected := data[5:14]; !bytes.Equal(state.Tasks[0].Unknown, expected) {
+		t.Errorf("Expected task unknown fields %x, got %x", expected, state.Tasks[0].Unknown)
+	}
+	if expected := data[14:]; !bytes.Equal(state.Unknown, expected) {
+		t.Errorf("Expected context unknown fields %x, got %x", expected, state.Unknown)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	t.Parallel()
+
+	data := [][]byte{
+		{0x0a},                   // missing length
+		{0x0a, 0x05, 0x0a},       // truncated task
+		{0x0a, 0x02, 0x10, 0x80}, // truncated varint in task
+		{0x0b},                   // group wire type
+		{0x00, 0x00},             // field number 0
+		{0x09, 0x01},             // truncated fixed64
+	}
+	for _, d := range data {
+		if _, err := Decode(d); err == nil {
+			t.Errorf("Expected an error decoding %x", d)
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	t.Parallel()
+
+	state, err := ReadFile(defaultContextPath)
+	if err != nil {
+		t.Fatal("Failed to read context:", err)
+	}
+	before := copyState(state)
+
+	state.Shift(-72 * time.Hour)
+	delta := Diff(before, state)
+	if len(delta.Modified) != len(state.Tasks) || len(delta.NewEntries) != len(state.Journal) {
+		t.Errorf("Expected every task and journal entry to change, got:\n%s", delta)
+	}
+	for i, task := range state.Tasks {
+		if expected := before.Tasks[i].Created.Add(-72 * time.Hour); !task.Created.Equal(expected) {
+			t.Errorf("Expected task %s to be created at %s, got %s", task.Name, expected, task.Created)
+		}
+	}
+	for i, entry := range state.Journal {
+		if expected := before.Journal[i].Date.Add(-72 * time.Hour); !entry.Date.Equal(expected) {
+			t.Errorf("Expected journal entry '%s' at %s, got %s", entry.Title, expected, entry.Date)
+		}
+	}
+
+	state.Shift(72 * time.Hour)
+	if delta := Diff(before, state); !delta.Empty() {
+		t.Errorf("Expected shifting back to undo the shift, got:\n%s", delta)
+	}
+}
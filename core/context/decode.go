@@ -0,0 +1,199 @@
+package context
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// These are the protobuf wire types (see
+// https://protobuf.dev/programming-guides/encoding/#structure).
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Decode the provided contents of a context file.
+func Decode(data []byte) (*State, error) {
+	state := &State{Tasks: []*Task{}, Journal: []*JournalEntry{}}
+	err := decodeMessage(data, func(field *field) error {
+		switch {
+		case field.number == 1 && field.wireType == wireBytes:
+			task, err := decodeTask(field.bytes)
+			if err != nil {
+				return err
+			}
+			state.Tasks = append(state.Tasks, task)
+		case field.number == 2 && field.wireType == wireBytes:
+			return decodeJournal(field.bytes, state)
+		default:
+			state.Unknown = append(state.Unknown, field.raw...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func decodeTask(data []byte) (*Task, error) {
+	task := &Task{Created: time.Unix(0, 0).UTC()}
+	err := decodeMessage(data, func(field *field) (err error) {
+		switch {
+		case field.number == 1 && field.wireType == wireBytes:
+			task.Name = string(field.bytes)
+		case field.number == 2 && field.wireType == wireVarint:
+			task.ID, err = decodeInt32(field)
+		case field.number == 4 && field.wireType == wireVarint:
+			task.Created = time.Unix(int64(field.varint), 0).UTC()
+		case field.number == 5 && field.wireType == wireVarint:
+			task.Priority, err = decodeInt32(field)
+		case field.number == 6 && field.wireType == wireVarint:
+			var value int32
+			value, err = decodeInt32(field)
+			task.State = TaskState(value)
+		default:
+			task.Unknown = append(task.Unknown, field.raw...)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid task: %s", err)
+	}
+	return task, nil
+}
+
+// Decode the provided journal into the provided state. A context can have its journal split into
+// more than one field, like any protobuf message, in which case the entries are appended.
+func decodeJournal(data []byte, state *State) error {
+	return decodeMessage(data, func(field *field) error {
+		if field.number == 1 && field.wireType == wireBytes {
+			entry, err := decodeJournalEntry(field.bytes)
+			if err != nil {
+				return err
+			}
+			state.Journal = append(state.Journal, entry)
+		} else {
+			state.JournalUnknown = append(state.JournalUnknown, field.raw...)
+		}
+		return nil
+	})
+}
+
+func decodeJournalEntry(data []byte) (*JournalEntry, error) {
+	entry := &JournalEntry{Date: time.Unix(0, 0).UTC()}
+	err := decodeMessage(data, func(field *field) (err error) {
+		switch {
+		case field.number == 1 && field.wireType == wireBytes:
+			entry.Title = string(field.bytes)
+		case field.number == 2 && field.wireType == wireVarint:
+			var value int32
+			value, err = decodeInt32(field)
+			entry.Type = EntryType(value)
+		case field.number == 3 && field.wireType == wireVarint:
+			entry.Date = time.Unix(int64(field.varint), 0).UTC()
+		case field.number == 4 && field.wireType == wireVarint:
+			entry.TaskID, err = decodeInt32(field)
+		default:
+			entry.Unknown = append(entry.Unknown, field.raw...)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid journal entry: %s", err)
+	}
+	return entry, nil
+}
+
+// field is a single field in an encoded protobuf message.
+type field struct {
+	number   uint64
+	wireType int
+
+	// This is the value of a varint field.
+	varint uint64
+	// This is the value of a length delimited field.
+	bytes []byte
+	// This is the whole encoded field, including its tag.
+	raw []byte
+}
+
+// Call the provided function with every field in the provided encoded message, in order, until it
+// returns an error.
+func decodeMessage(data []byte, f func(*field) error) error {
+	for offset := 0; offset < len(data); {
+		start := offset
+		tag, n := decodeVarint(data[offset:])
+		if n == 0 {
+			return fmt.Errorf("Invalid tag at offset %d", offset)
+		}
+		offset += n
+
+		field := &field{number: tag >> 3, wireType: int(tag & 7)}
+		if field.number == 0 {
+			return fmt.Errorf("Invalid field number 0 at offset %d", start)
+		}
+		switch field.wireType {
+		case wireVarint:
+			if field.varint, n = decodeVarint(data[offset:]); n == 0 {
+				return fmt.Errorf("Invalid varint for field %d at offset %d", field.number, offset)
+			}
+			offset += n
+		case wireFixed64, wireFixed32:
+			size := 8
+			if field.wireType == wireFixed32 {
+				size = 4
+			}
+			if len(data)-offset < size {
+				return fmt.Errorf("Truncated field %d at offset %d", field.number, offset)
+			}
+			offset += size
+		case wireBytes:
+			length, n := decodeVarint(data[offset:])
+			if n == 0 {
+				return fmt.Errorf("Invalid length for field %d at offset %d", field.number, offset)
+			}
+			offset += n
+			if length > uint64(len(data)-offset) {
+				return fmt.Errorf("Truncated field %d at offset %d", field.number, offset)
+			}
+			field.bytes = data[offset : offset+int(length)]
+			offset += int(length)
+		default:
+			return fmt.Errorf("Unsupported wire type %d for field %d at offset %d", field.wireType,
+				field.number, start)
+		}
+		field.raw = data[start:offset]
+
+		if err := f(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the value of the provided int32 field. Like other protobuf int types, a negative int32 is
+// encoded as a 64 bit two's complement varint, so anything that does not fit in 32 bits is invalid.
+func decodeInt32(field *field) (int32, error) {
+	value := int64(field.varint)
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		return 0, fmt.Errorf("Value %d of field %d is out of range", value, field.number)
+	}
+	return int32(value), nil
+}
+
+// Decode the varint at the start of the provided data. Returns the value and the number of bytes
+// that it took up, or 0 bytes if the varint is invalid.
+func decodeVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,149 @@
+package context
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Delta is the difference between two States, e.g., what a command changed in a context. Tasks are
+// matched up by ID.
+type Delta struct {
+	// These are the tasks that are only in the second State.
+	Added []*Task
+	// These are the tasks that are only in the first State.
+	Removed []*Task
+	// These are the tasks that are in both States, but are different.
+	Modified []*TaskDelta
+
+	// These are the journal entries at the end of the second State's journal that are not in the
+	// first State's journal, oldest entry first.
+	NewEntries []*JournalEntry
+	// These are the journal entries from the first State that are no longer in the journal of the
+	// second State (e.g., after "anwork reset"), oldest entry first. Since anwork only ever appends
+	// to the journal, every entry after the first difference is considered removed.
+	RemovedEntries []*JournalEntry
+}
+
+// TaskDelta describes how a single task changed between two States.
+type TaskDelta struct {
+	Before, After *Task
+	// These are the fields of the task that changed.
+	Changes []FieldChange
+}
+
+// FieldChange is a single field of a task that changed, e.g., its priority.
+type FieldChange struct {
+	// This is the name of the field, e.g., "priority".
+	Field string
+	// These are the values of the field before and after the change, like they are printed in
+	// Delta.String.
+	Before, After string
+}
+
+// Returns the difference between the provided States.
+func Diff(before, after *State) *Delta {
+	delta := &Delta{
+		Added:          []*Task{},
+		Removed:        []*Task{},
+		Modified:       []*TaskDelta{},
+		NewEntries:     []*JournalEntry{},
+		RemovedEntries: []*JournalEntry{},
+	}
+
+	afterTasks := map[int32]*Task{}
+	for _, task := range after.Tasks {
+		afterTasks[task.ID] = task
+	}
+	beforeTasks := map[int32]*Task{}
+	for _, task := range before.Tasks {
+		beforeTasks[task.ID] = task
+		if afterTask, ok := afterTasks[task.ID]; !ok {
+			delta.Removed = append(delta.Removed, task)
+		} else if changes := diffTasks(task, afterTask); len(changes) > 0 {
+			delta.Modified = append(delta.Modified, &TaskDelta{Before: task, After: afterTask, Changes: changes})
+		}
+	}
+	for _, task := range after.Tasks {
+		if _, ok := beforeTasks[task.ID]; !ok {
+			delta.Added = append(delta.Added, task)
+		}
+	}
+
+	common := 0
+	for common < len(before.Journal) && common < len(after.Journal) &&
+		sameEntry(before.Journal[common], after.Journal[common]) {
+		common++
+	}
+	delta.RemovedEntries = append(delta.RemovedEntries, before.Journal[common:]...)
+	delta.NewEntries = append(delta.NewEntries, after.Journal[common:]...)
+
+	return delta
+}
+
+// Returns true iff nothing changed.
+func (delta *Delta) Empty() bool {
+	return len(delta.Added) == 0 && len(delta.Removed) == 0 && len(delta.Modified) == 0 &&
+		len(delta.NewEntries) == 0 && len(delta.RemovedEntries) == 0
+}
+
+// Returns a line for every change in this Delta. An added task looks like
+// "+ task task-c (2): created 2018-01-15T23:59:52Z, priority 10, state WAITING", a removed task looks
+// like "- task task-b (1)", and every field that changed in a modified task gets a line like
+// "~ task task-a (0): state WAITING -> RUNNING". New journal entries look like
+// "+ journal: [2018-01-15T23:59:57Z] Set state on task task-a from Waiting to Running", and removed
+// ones start with "- journal:" instead. Times are printed in UTC, so that the lines do not depend on the local time zone.
+func (delta *Delta) Lines() []string {
+	lines := []string{}
+	for _, task := range delta.Added {
+		lines = append(lines, fmt.Sprintf("+ task %s (%d): created %s, priority %d, state %s", task.Name,
+			task.ID, formatTime(task.Created), task.Priority, task.State))
+	}
+	for _, task := range delta.Removed {
+		lines = append(lines, fmt.Sprintf("- task %s (%d)", task.Name, task.ID))
+	}
+	for _, task := range delta.Modified {
+		for _, change := range task.Changes {
+			lines = append(lines, fmt.Sprintf("~ task %s (%d): %s %s -> %s", task.Before.Name, task.Before.ID,
+				change.Field, change.Before, change.After))
+		}
+	}
+	for _, entry := range delta.NewEntries {
+		lines = append(lines, fmt.Sprintf("+ journal: [%s] %s", formatTime(entry.Date), entry.Title))
+	}
+	for _, entry := range delta.RemovedEntries {
+		lines = append(lines, fmt.Sprintf("- journal: [%s] %s", formatTime(entry.Date), entry.Title))
+	}
+	return lines
+}
+
+// Returns the Lines of this Delta, one per line.
+func (delta *Delta) String() string {
+	return strings.Join(delta.Lines(), "\n")
+}
+
+// Returns the fields that are different between the provided tasks.
+func diffTasks(before, after *Task) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, FieldChange{Field: field, Before: before, After: after})
+		}
+	}
+	add("name", before.Name, after.Name)
+	add("created", formatTime(before.Created), formatTime(after.Created))
+	add("priority", fmt.Sprint(before.Priority), fmt.Sprint(after.Priority))
+	add("state", before.State.String(), after.State.String())
+	add("unknown", fmt.Sprintf("%x", before.Unknown), fmt.Sprintf("%x", after.Unknown))
+	return changes
+}
+
+func sameEntry(a, b *JournalEntry) bool {
+	return a.Title == b.Title && a.Type == b.Type && a.Date.Equal(b.Date) && a.TaskID == b.TaskID &&
+		bytes.Equal(a.Unknown, b.Unknown)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
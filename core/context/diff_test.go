@@ -0,0 +1,68 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1516060787, 0)
+	builder := NewBuilder().
+		Create("task-a", start).
+		Create("task-b", start.Add(time.Second))
+	before, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before = copyState(before)
+
+	after, err := builder.
+		SetState("task-a", Running, start.Add(2*time.Second)).
+		SetPriority("task-a", 5, start.Add(3*time.Second)).
+		Delete("task-b", start.Add(4*time.Second)).
+		Create("task-c", start.Add(5*time.Second)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delta := Diff(before, after)
+	expected := []string{
+		"+ task task-c (2): created 2018-01-15T23:59:52Z, priority 10, state WAITING",
+		"- task task-b (1)",
+		"~ task task-a (0): priority 10 -> 5",
+		"~ task task-a (0): state WAITING -> RUNNING",
+		"+ journal: [2018-01-15T23:59:49Z] Set state on task task-a from Waiting to Running",
+		"+ journal: [2018-01-15T23:59:50Z] Set priority on task task-a from 10 to 5",
+		"+ journal: [2018-01-15T23:59:51Z] Deleted task task-b",
+		"+ journal: [2018-01-15T23:59:52Z] Created task task-c",
+	}
+	if lines := delta.Lines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected delta:\n%q\ngot:\n%q", expected, lines)
+	}
+	if delta.Empty() {
+		t.Error("Expected delta not to be empty")
+	}
+
+	// Going backwards, the journal entries are removed.
+	delta = Diff(after, before)
+	if len(delta.RemovedEntries) != 4 || len(delta.NewEntries) != 0 {
+		t.Errorf("Expected 4 removed journal entries, got %s", delta)
+	}
+
+	if delta := Diff(after, after); !delta.Empty() || len(delta.Lines()) != 0 {
+		t.Errorf("Expected no difference between a state and itself, got %s", delta)
+	}
+}
+
+// Returns a copy of the provided state that does not share any tasks or entries with it.
+func copyState(state *State) *State {
+	state, err := Decode(Encode(state))
+	if err != nil {
+		panic(err)
+	}
+	return state
+}
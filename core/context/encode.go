@@ -0,0 +1,82 @@
+package context
+
+import (
+	"io/ioutil"
+)
+
+// Encode the provided state into the contents of a context file, the same way that anwork does:
+// fields are written in field number order, fields with zero values are left out, and any unknown
+// fields are written after the known ones. Decoding a context file that anwork wrote and encoding it
+// again results in the same bytes.
+func Encode(state *State) []byte {
+	data := []byte{}
+	for _, task := range state.Tasks {
+		data = appendBytesField(data, 1, encodeTask(task))
+	}
+	if len(state.Journal) > 0 || len(state.JournalUnknown) > 0 {
+		journal := []byte{}
+		for _, entry := range state.Journal {
+			journal = appendBytesField(journal, 1, encodeJournalEntry(entry))
+		}
+		journal = append(journal, state.JournalUnknown...)
+		data = appendBytesField(data, 2, journal)
+	}
+	return append(data, state.Unknown...)
+}
+
+// Write the provided state to the context file at the provided path. See Encode.
+func WriteFile(path string, state *State) error {
+	return ioutil.WriteFile(path, Encode(state), 0644)
+}
+
+func encodeTask(task *Task) []byte {
+	data := []byte{}
+	data = appendStringField(data, 1, task.Name)
+	data = appendVarintField(data, 2, uint64(int64(task.ID)))
+	data = appendVarintField(data, 4, uint64(task.Created.Unix()))
+	data = appendVarintField(data, 5, uint64(int64(task.Priority)))
+	data = appendVarintField(data, 6, uint64(int64(task.State)))
+	return append(data, task.Unknown...)
+}
+
+func encodeJournalEntry(entry *JournalEntry) []byte {
+	data := []byte{}
+	data = appendStringField(data, 1, entry.Title)
+	data = appendVarintField(data, 2, uint64(int64(entry.Type)))
+	data = appendVarintField(data, 3, uint64(entry.Date.Unix()))
+	data = appendVarintField(data, 4, uint64(int64(entry.TaskID)))
+	return append(data, entry.Unknown...)
+}
+
+// Append the provided varint field to the provided data, unless its value is 0.
+func appendVarintField(data []byte, number, value uint64) []byte {
+	if value == 0 {
+		return data
+	}
+	data = appendVarint(data, number<<3|wireVarint)
+	return appendVarint(data, value)
+}
+
+// Append the provided string field to the provided data, unless it is empty.
+func appendStringField(data []byte, number uint64, value string) []byte {
+	if value == "" {
+		return data
+	}
+	return appendBytesField(data, number, []byte(value))
+}
+
+// Append the provided length delimited field to the provided data. Unlike a string field, it is
+// written even if it is empty, because an empty message is not the same as a missing one.
+func appendBytesField(data []byte, number uint64, value []byte) []byte {
+	data = appendVarint(data, number<<3|wireBytes)
+	data = appendVarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func appendVarint(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
@@ -0,0 +1,60 @@
+package context
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile(defaultContextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := Decode(data)
+	if err != nil {
+		t.Fatal("Failed to decode context:", err)
+	}
+	if encoded := Encode(state); !bytes.Equal(encoded, data) {
+		t.Errorf("Expected encoded context to be the same as %s:\n%x\ngot:\n%x", defaultContextPath, data,
+			encoded)
+	}
+
+	// Unknown fields should make it through as well.
+	data = append(data, 0x1d, 0x01, 0x02, 0x03, 0x04)
+	if state, err = Decode(data); err != nil {
+		t.Fatal("Failed to decode context:", err)
+	}
+	if encoded := Encode(state); !bytes.Equal(encoded, data) {
+		t.Errorf("Expected encoded context with unknown fields to be:\n%x\ngot:\n%x", data, encoded)
+	}
+}
+
+func TestEncodeValues(t *testing.T) {
+	t.Parallel()
+
+	expected := &State{
+		Tasks: []*Task{
+			{Name: "negative", ID: -1, Created: time.Unix(1<<40, 0), Priority: -20, State: Blocked},
+			{Name: "", ID: 0, Created: time.Unix(0, 0)},
+		},
+		Journal: []*JournalEntry{},
+	}
+	state, err := Decode(Encode(expected))
+	if err != nil {
+		t.Fatal("Failed to decode context:", err)
+	}
+	if len(state.Tasks) != 2 || len(state.Journal) != 0 {
+		t.Fatalf("Expected 2 tasks and no journal, got %+v", state)
+	}
+	for i, task := range state.Tasks {
+		if task.Name != expected.Tasks[i].Name || task.ID != expected.Tasks[i].ID ||
+			!task.Created.Equal(expected.Tasks[i].Created) || task.Priority != expected.Tasks[i].Priority ||
+			task.State != expected.Tasks[i].State {
+			t.Errorf("Expected task %d to be %+v, got %+v", i, *expected.Tasks[i], *task)
+		}
+	}
+}
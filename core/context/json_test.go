@@ -0,0 +1,56 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile(defaultContextPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add an unknown field to the context, so that it has to make it through JSON too.
+	data = append(data, 0x1d, 0x01, 0x02, 0x03, 0x04)
+	state, err := Decode(data)
+	if err != nil {
+		t.Fatal("Failed to decode context:", err)
+	}
+	state.Tasks[0].State = 7
+
+	contents, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		t.Fatal("Failed to marshal JSON:", err)
+	}
+	for _, expected := range []string{
+		`"name": "task-b"`,
+		`"state": "BLOCKED"`,
+		`"state": "7"`,
+		`"created": "2018-01-15T23:59:50Z"`,
+		`"type": "set state"`,
+		`"taskId": 2`,
+		`"unknown": "HQECAwQ="`,
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected JSON to contain %s, got:\n%s", expected, contents)
+		}
+	}
+
+	var parsed State
+	if err := json.Unmarshal(contents, &parsed); err != nil {
+		t.Fatal("Failed to unmarshal JSON:", err)
+	}
+	parsed.Tasks[0].State = Finished
+	if encoded := Encode(&parsed); !bytes.Equal(encoded, data) {
+		t.Errorf("Expected context from JSON to be:\n%x\ngot:\n%x", data, encoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"tasks": [{"state": "SLEEPING"}]}`), &parsed); err == nil {
+		t.Error("Expected an error unmarshaling an unknown state")
+	}
+}
@@ -0,0 +1,137 @@
+package context
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned from Validate when a context breaks the invariants that anwork keeps,
+// which means that it is corrupt (e.g., because a command was interrupted while writing it).
+type ValidationError struct {
+	// This describes every broken invariant.
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "Invalid context:\n  " + strings.Join(err.Problems, "\n  ")
+}
+
+// This matches the title of a SetPriorityEntry (see Builder.SetPriority), capturing the old and new
+// priorities.
+var setPriorityTitleRegex = regexp.MustCompile(`^Set priority on task .* from (-?\d+) to (-?\d+)$`)
+
+// Returns a *ValidationError describing every invariant that this state breaks, or nil if it is a
+// state that anwork could have written. These are the invariants.
+//   - Task names and IDs are unique, and every task has a creation time.
+//   - Every task was created by a journal entry, so its ID is below the next task ID (which anwork
+//     gets from the journal), and no task has been deleted by a journal entry.
+//   - Journal entries are in time order, and they only refer to tasks that were created (and not
+//     yet deleted) by an earlier journal entry.
+//   - States and journal entry types are ones that anwork knows about.
+//   - Priorities are in range, i.e., they fit in an int32. The Priority of a Task is an int32, so
+//     this is about set-priority journal entries: anwork records the priority that it was asked for,
+//     but it silently wraps a priority that does not fit when it stores it on the task.
+func (state *State) Validate() error {
+	problems := []string{}
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Replay the journal, keeping track of which tasks are alive.
+	const (
+		created = iota + 1
+		deleted
+	)
+	lifecycle := map[int32]int{}
+	var nextID int32
+	for i, entry := range state.Journal {
+		if i > 0 && entry.Date.Before(state.Journal[i-1].Date) {
+			addProblem("Journal entry %d ('%s') is dated %s, before the entry before it (%s)", i, entry.Title,
+				formatTime(entry.Date), formatTime(state.Journal[i-1].Date))
+		}
+
+		switch {
+		case entry.Type < CreateEntry || entry.Type > SetPriorityEntry:
+			addProblem("Journal entry %d ('%s') has unknown type %s", i, entry.Title, entry.Type)
+		case entry.Type == CreateEntry:
+			if lifecycle[entry.TaskID] != 0 {
+				addProblem("Journal entry %d ('%s') creates task %d again", i, entry.Title, entry.TaskID)
+			}
+			lifecycle[entry.TaskID] = created
+			if entry.TaskID >= nextID {
+				nextID = entry.TaskID + 1
+			}
+		case lifecycle[entry.TaskID] == 0:
+			addProblem("Journal entry %d ('%s') is for task %d, which was never created", i, entry.Title,
+				entry.TaskID)
+		case lifecycle[entry.TaskID] == deleted:
+			addProblem("Journal entry %d ('%s') is for task %d, which was already deleted", i, entry.Title,
+				entry.TaskID)
+		case entry.Type == DeleteEntry:
+			lifecycle[entry.TaskID] = deleted
+		case entry.Type == SetPriorityEntry:
+			if match := setPriorityTitleRegex.FindStringSubmatch(entry.Title); match != nil {
+				for _, priority := range match[1:] {
+					if _, err := strconv.ParseInt(priority, 10, 32); err != nil {
+						addProblem("Journal entry %d ('%s') has priority %s, which is out of range", i, entry.Title,
+							priority)
+					}
+				}
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	ids := map[int32]bool{}
+	for _, task := range state.Tasks {
+		if names[task.Name] {
+			addProblem("There is more than one task named '%s'", task.Name)
+		}
+		names[task.Name] = true
+		if ids[task.ID] {
+			addProblem("There is more than one task with ID %d", task.ID)
+		}
+		ids[task.ID] = true
+
+		if task.State < Waiting || task.State > Finished {
+			addProblem("Task '%s' has unknown state %s", task.Name, task.State)
+		}
+		if task.Created.Unix() <= 0 {
+			addProblem("Task '%s' has no creation time", task.Name)
+		}
+
+		if task.ID < 0 || task.ID >= nextID {
+			addProblem("Task '%s' has ID %d, which is not below the next task ID %d", task.Name, task.ID, nextID)
+		} else if lifecycle[task.ID] == 0 {
+			addProblem("Task '%s' (%d) was never created in the journal", task.Name, task.ID)
+		} else if lifecycle[task.ID] == deleted {
+			addProblem("Task '%s' (%d) was deleted in the journal", task.Name, task.ID)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Decode and validate (see State.Validate) the context file at the provided path. A context file
+// that does not exist is valid, since it is the empty state.
+func ValidateFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	state, err := Decode(data)
+	if err != nil {
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+	return state.Validate()
+}
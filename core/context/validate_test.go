@@ -0,0 +1,94 @@
+package context
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := ValidateFile(defaultContextPath); err != nil {
+		t.Error("Expected default context to be valid:", err)
+	}
+
+	start := time.Unix(1516060787, 0)
+	valid := func() *Builder {
+		return NewBuilder().
+			Create("task-a", start).
+			Create("task-b", start.Add(time.Second)).
+			SetState("task-a", Running, start.Add(2*time.Second)).
+			Delete("task-b", start.Add(3*time.Second)).
+			Create("task-c", start.Add(4*time.Second)).
+			SetPriority("task-c", -5, start.Add(5*time.Second))
+	}
+	mustBuild := func(builder *Builder) *State {
+		state, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+	if err := mustBuild(valid()).Validate(); err != nil {
+		t.Error("Expected built state to be valid:", err)
+	}
+
+	data := []struct {
+		problem string
+		corrupt func(*State)
+	}{
+		{"more than one task named 'task-a'", func(state *State) { state.Tasks[1].Name = "task-a" }},
+		{"more than one task with ID 0", func(state *State) { state.Tasks[1].ID = 0 }},
+		{"unknown state TaskState(7)", func(state *State) { state.Tasks[0].State = 7 }},
+		{"no creation time", func(state *State) { state.Tasks[0].Created = time.Unix(0, 0) }},
+		{"not below the next task ID 3", func(state *State) { state.Tasks[1].ID = 5 }},
+		{"was deleted in the journal", func(state *State) { state.Tasks[1].ID = 1 }},
+		{"before the entry before it", func(state *State) { state.Journal[2].Date = start.Add(-time.Hour) }},
+		{"unknown type EntryType(9)", func(state *State) { state.Journal[2].Type = 9 }},
+		{"creates task 0 again", func(state *State) { state.Journal[1].TaskID = 0 }},
+		{"never created", func(state *State) { state.Journal[2].TaskID = 8 }},
+		{"already deleted", func(state *State) {
+			state.Journal = append(state.Journal, &JournalEntry{Type: NoteEntry, Date: start.Add(time.Hour), TaskID: 1})
+		}},
+		{"not below the next task ID 2", func(state *State) { state.Journal = state.Journal[:4] }},
+		{"priority 99999999999, which is out of range", func(state *State) {
+			state.Journal[5].Title = "Set priority on task task-c from 10 to 99999999999"
+		}},
+		{"priority -2147483649, which is out of range", func(state *State) {
+			state.Journal[5].Title = "Set priority on task task-c from -2147483649 to -5"
+		}},
+		{"was never created in the journal", func(state *State) {
+			state.Tasks = append(state.Tasks, &Task{Name: "task-d", ID: 1, Created: start})
+			state.Journal[1].TaskID, state.Journal[3].TaskID = 3, 3
+		}},
+	}
+	for _, d := range data {
+		state := mustBuild(valid())
+		d.corrupt(state)
+
+		err := state.Validate()
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("Expected a *ValidationError for '%s', got %v", d.problem, err)
+		} else if !strings.Contains(err.Error(), d.problem) {
+			t.Errorf("Expected error to contain '%s', got: %s", d.problem, err)
+		}
+	}
+}
+
+func TestDecodeOutOfRange(t *testing.T) {
+	t.Parallel()
+
+	// A task with ID 2^32, and a task with ID -1 (which is encoded as a 10 byte varint).
+	if _, err := Decode([]byte{0x0a, 0x06, 0x10, 0x80, 0x80, 0x80, 0x80, 0x10}); err == nil {
+		t.Error("Expected an error decoding an out of range task ID")
+	}
+	state, err := Decode([]byte{0x0a, 0x0b, 0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	if err != nil {
+		t.Fatal("Failed to decode negative task ID:", err)
+	} else if state.Tasks[0].ID != -1 {
+		t.Errorf("Expected task ID -1, got %d", state.Tasks[0].ID)
+	}
+}
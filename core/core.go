@@ -5,7 +5,7 @@
 // 1. The RunTests function MUST be called from a TestMain function in the test package that wants to
 // use this test framework. Here is an example of a test that uses this test framework.
 //
-//   var version int // global variable
+//   var version core.Version // global variable
 //   ...
 //   func TestMain(m *testing.M) {
 //     core.RunTests(m, &version)
@@ -28,18 +28,51 @@ package core
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 )
 
 // This function MUST be called from a TestMain function inside the test package that wants to use
 // this test framework. This function parses a version argument passed to the test executable. If no
 // version argument is passed (via the -v flag), then this function will panic.
-func RunTests(m *testing.M, version *int) {
-	flag.IntVar(version, "v", 0, "The anwork version that should be used with these tests")
+//
+// A locally built anwork binary can be tested by passing the -binary or -source flags (or by setting
+// the LocalBinaryEnv or LocalSourceEnv environment variables). See LocalBuild. When a local build is
+// used and no version is passed, the version reported by the local binary is used.
+//
+// The releases come from the release directory in this repo by default. A different ReleaseSource
+// can be used by passing the -release flag (or by setting the ReleaseEnv environment variable).
+func RunTests(m *testing.M, version *Version) {
+	var binary, source, release string
+	flag.Var(version, "v", "The anwork version (e.g., 2 or 3.1) that should be used with these tests")
+	flag.StringVar(&binary, "binary", os.Getenv(LocalBinaryEnv), "A locally built anwork binary to test")
+	flag.StringVar(&source, "source", os.Getenv(LocalSourceEnv), "An anwork checkout to build and test")
+	flag.StringVar(&release, "release", os.Getenv(ReleaseEnv), "A release directory, archive, or tree")
 	flag.Parse()
 
-	if *version == 0 {
+	if release != "" {
+		source, err := MakeReleaseSource(release)
+		if err != nil {
+			panic("Cannot use release source " + release + ": " + err.Error())
+		}
+		setReleaseSource(source)
+	}
+
+	if build := makeLocalBuild(binary, source); build != nil {
+		setLocalBuild(build)
+		binaryPath, localVersion, err := build.Resolve()
+		if err != nil {
+			panic("Cannot use " + build.String() + ": " + err.Error())
+		}
+		fmt.Printf("Using %s at %s (version %s)\n", build, binaryPath, localVersion)
+		if version.IsZero() {
+			*version = localVersion
+		}
+	}
+
+	if version.IsZero() {
 		panic("Version (-v) must be passed with a legitimate anwork version number")
 	}
 
@@ -49,12 +82,9 @@ func RunTests(m *testing.M, version *int) {
 // This function allocates an Anwork struct with the provided version and then runs the provided
 // function b.N number of times. It resets the b timer (with b.ResetTimer()) right before it runs
 // the function. The integer argument to the function is the number of benchmark iteration that is
-// being run.
-func RunBenchmark(b *testing.B, version int, f func(*Anwork, int)) {
-	a, err := MakeAnwork(version)
-	if err != nil {
-		b.Fatal(err)
-	}
+// being run. The benchmark is skipped if the version cannot run on this machine (see MustMakeAnwork).
+func RunBenchmark(b *testing.B, version Version, f func(*Anwork, int)) {
+	a := MustMakeAnwork(b, version)
 	defer a.Close()
 
 	b.ResetTimer()
@@ -62,3 +92,28 @@ func RunBenchmark(b *testing.B, version int, f func(*Anwork, int)) {
 		f(a, i)
 	}
 }
+
+// This function is like RunBenchmark, except that the provided function returns the commands that
+// should be run on the Anwork instance for the i'th benchmark iteration. Each command is run via
+// Anwork.Execute; if a command fails, then the benchmark fails. The average wall clock time of a
+// single command is reported as the "ns/command" metric.
+func RunCommandBenchmark(b *testing.B, version Version, f func(int) [][]string) {
+	var total time.Duration
+	var count int
+	RunBenchmark(b, version, func(a *Anwork, i int) {
+		for _, command := range f(i) {
+			result, err := a.Execute(command...)
+			if err == nil {
+				err = result.Err()
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			total += result.Duration
+			count++
+		}
+	})
+	if count > 0 {
+		b.ReportMetric(float64(total.Nanoseconds())/float64(count), "ns/command")
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
 )
 
 // This structure represents a command passed to an Anwork instance and a number of expected regular
 // expressions to be matched against the data printed to stdout by running the Anwork instance. This
 // struct is meant to be initialized manually, like this.
-//   anwork := core.MakeAnwork(1) // version
+//   anwork := core.MakeAnwork(core.MajorVersion(1)) // version
 //   expect := Expect{Anwork: anwork, Command: "foo", Regexes: []string{".*bar.*", "^bat$"}}
 type Expect struct {
 	// This is the Anwork instance that this expect will use to run.
@@ -34,25 +36,39 @@ type Expect struct {
 // successfully matched against n expect.Regexs. If a expect.Regex is not found in the output lines,
 // then the length of the returned slice will not match the length of the passed expect.Regex slice.
 func (expect *Expect) Run(t *testing.T) ([]string, error) {
+	_, matchedLines, err := expect.Execute(t)
+	return matchedLines, err
+}
+
+// This function is the same as Expect.Run, except that it also returns the RunResult from running
+// the expect.Command. The RunResult will be non-nil whenever the command was able to be run, even
+// if the command exited with a non-zero status.
+func (expect *Expect) Execute(t *testing.T) (*RunResult, []string, error) {
 	if expect.Anwork == nil {
-		return nil, errors.New(fmt.Sprintf("Invalid expect struct: %#v", expect))
+		return nil, nil, errors.New(fmt.Sprintf("Invalid expect struct: %#v", expect))
 	}
 
-	output, err := expect.Anwork.Run(expect.Command...)
+	result, err := expect.Anwork.Execute(expect.Command...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	t.Logf("Got output from '%s' command (took %s):\n%s", expect.Command, result.Duration, result.Stdout)
+	if len(result.Stderr) > 0 {
+		t.Logf("Got stderr from '%s' command:\n%s", expect.Command, result.Stderr)
+	}
+	if err := result.Err(); err != nil {
+		return result, nil, err
 	}
-	t.Logf("Got output from '%s' command:\n%s", expect.Command, output)
 
-	outputLines := makeOutputLines(output)
+	outputLines := makeOutputLines(result.Stdout)
 
 	matchedLines, err := getMatchedLines(outputLines, expect.Regexes)
 	if err != nil {
-		return nil, err
+		return result, nil, err
 	}
 	t.Logf("Matched lines '%s' from regexes '%s'", matchedLines, expect.Regexes)
 
-	return matchedLines, nil
+	return result, matchedLines, nil
 }
 
 // This is a helper method to run a bunch of Expect structs and log the errors to a testing.T struct.
@@ -69,6 +85,72 @@ func Run(t *testing.T, expects ...Expect) {
 	}
 }
 
+// This structure is an Expect that also checks what its command changed in the context of its
+// Anwork instance. The Delta regular expressions are matched against the lines of the change (see
+// anworkcontext.Delta.Lines) one for one, so every change that the command made has to be expected.
+// An empty Delta means that the command should not change anything.
+//   expect := DeltaExpect{
+//     Expect{anwork, []string{"set-running", "task-a"}, []string{}},
+//     []string{"~ task task-a .*: state WAITING -> RUNNING", "\\+ journal: .*to Running"},
+//   }
+type DeltaExpect struct {
+	Expect
+
+	// These are the regular expressions that are matched against the lines of the change that the
+	// command made to the context.
+	Delta []string
+}
+
+// This function is the same as Expect.Run, except that it also returns an error if the change that
+// the command made to the context does not match the expect.Delta regular expressions.
+func (expect *DeltaExpect) Run(t *testing.T) ([]string, error) {
+	if expect.Anwork == nil {
+		return nil, errors.New(fmt.Sprintf("Invalid expect struct: %#v", expect))
+	}
+
+	before, err := expect.Anwork.State()
+	if err != nil {
+		return nil, err
+	}
+
+	_, matchedLines, err := expect.Execute(t)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := expect.Anwork.State()
+	if err != nil {
+		return nil, err
+	}
+	delta := anworkcontext.Diff(before, after)
+	t.Logf("Got context change from '%s' command:\n%s", expect.Command, delta)
+
+	deltaLines := delta.Lines()
+	matchedDelta, err := getMatchedLines(deltaLines, expect.Delta)
+	if err != nil {
+		return nil, err
+	} else if len(matchedDelta) != len(expect.Delta) || len(deltaLines) != len(expect.Delta) {
+		return nil, fmt.Errorf("Context change from '%s' command did not match %q:\n%s", expect.Command,
+			expect.Delta, delta)
+	}
+
+	return matchedLines, nil
+}
+
+// This is the same as Run, except for DeltaExpect structs.
+func RunDeltas(t *testing.T, expects ...DeltaExpect) {
+	for _, expect := range expects {
+		matched, err := expect.Run(t)
+		callerStr := getCallerStr()
+		if err != nil {
+			t.Errorf("%s: Got error when running DeltaExpect struct %s: %s", callerStr, expect, err)
+		} else if len(matched) != len(expect.Regexes) {
+			t.Errorf("%s: Did not match regex '%s' when running DeltaExpect struct %s",
+				callerStr, expect.Regexes[len(matched)], expect)
+		}
+	}
+}
+
 func getCallerStr() string {
 	_, file, line, ok := runtime.Caller(2) // we want the caller of the caller of this function
 	if !ok {
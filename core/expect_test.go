@@ -161,9 +161,49 @@ func areSlicesEqual(slice1, slice2 []string) bool {
 }
 
 func mustGetAnwork(t *testing.T) *Anwork {
-	anwork, err := MakeAnwork(1) // version
+	return MustMakeAnwork(t, MajorVersion(1)) // version
+}
+
+func TestDeltaExpect(t *testing.T) {
+	t.Parallel()
+
+	anwork := MustMakeAnwork(t, defaultVersion)
+
+	expects := []DeltaExpect{
+		DeltaExpect{
+			Expect{anwork, []string{"create", "task-a"}, []string{}},
+			[]string{`\+ task task-a \(0\): .*priority 10, state WAITING`, `\+ journal: .*Created task task-a`},
+		},
+		DeltaExpect{
+			Expect{anwork, []string{"set-running", "task-a"}, []string{}},
+			[]string{"~ task task-a .*: state WAITING -> RUNNING", `\+ journal: .*to Running`},
+		},
+		DeltaExpect{
+			Expect{anwork, []string{"show"}, []string{"RUNNING.*", ".*task-a.*"}},
+			[]string{},
+		},
+	}
+	RunDeltas(t, expects...)
+
+	// An unexpected change, a missing change, and a change that does not match should all fail.
+	bads := []DeltaExpect{
+		DeltaExpect{Expect{anwork, []string{"create", "task-b"}, []string{}}, []string{}},
+		DeltaExpect{Expect{anwork, []string{"show"}, []string{}}, []string{`\+ task .*`}},
+		DeltaExpect{
+			Expect{anwork, []string{"set-blocked", "task-a"}, []string{}},
+			[]string{"~ task task-a .*: state RUNNING -> FINISHED", `\+ journal: .*`},
+		},
+	}
+	for _, bad := range bads {
+		if _, err := bad.Run(t); err == nil {
+			t.Errorf("Expected an error for DeltaExpect struct %v", bad)
+		}
+	}
+
+	_, delta, err := anwork.ExecuteDelta("delete", "task-b")
 	if err != nil {
-		t.Fatalf("Received fatal error when trying to make anwork struct: %s", err)
+		t.Fatal(err)
+	} else if len(delta.Removed) != 1 || delta.Removed[0].Name != "task-b" || len(delta.NewEntries) != 1 {
+		t.Errorf("Expected task-b to be deleted, got:\n%s", delta)
 	}
-	return anwork
 }
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This is the directory in the cache directory where hashes of release archives are remembered
+// across processes (see hashFileCached). It starts with a dot so that ListCache skips it.
+const hashCacheDir = ".hashes"
+
+// This identifies a version of a file: if any of these change, then the file is hashed again.
+type fileHashKey struct {
+	path    string
+	size    int64
+	modTime int64
+	inode   uint64
+}
+
+// This is the (eventual) hash of a file. The once makes sure that parallel tests that want the hash
+// of the same file only read it once.
+type fileHashResult struct {
+	once sync.Once
+	hash string
+	err  error
+}
+
+// These are the hashes of files that have been computed by this process.
+var fileHashes = map[fileHashKey]*fileHashResult{}
+
+// This is the lock that guards the fileHashes variable.
+var fileHashesMutex sync.Mutex
+
+// Returns the hex SHA-256 of the file at the provided path. The file is streamed through the hash,
+// and the result is remembered for as long as the file's size, modification time, and inode stay the
+// same.
+func hashFile(path string) (string, error) {
+	key, err := makeFileHashKey(path)
+	if err != nil {
+		return "", err
+	}
+	return getFileHashResult(key, func() (string, error) {
+		return reallyHashFile(path)
+	})
+}
+
+// This is the same as hashFile, except that the hash is also remembered in the provided cache
+// directory, so that other test processes do not need to hash the file again.
+func hashFileCached(path, cacheDir string) (string, error) {
+	key, err := makeFileHashKey(path)
+	if err != nil {
+		return "", err
+	}
+	return getFileHashResult(key, func() (string, error) {
+		recordPath := makeHashRecordPath(cacheDir, key)
+		if contents, err := ioutil.ReadFile(recordPath); err == nil && isHexHash(string(contents)) {
+			return string(contents), nil
+		}
+
+		hash, err := reallyHashFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		// Failing to remember the hash is not a big deal; we will just hash the file again next time.
+		writeHashRecord(recordPath, hash)
+		return hash, nil
+	})
+}
+
+func makeFileHashKey(path string) (fileHashKey, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fileHashKey{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileHashKey{}, err
+	}
+
+	return fileHashKey{
+		path:    path,
+		size:    info.Size(),
+		modTime: info.ModTime().UnixNano(),
+		inode:   getInode(info),
+	}, nil
+}
+
+func getFileHashResult(key fileHashKey, hash func() (string, error)) (string, error) {
+	fileHashesMutex.Lock()
+	result, ok := fileHashes[key]
+	if !ok {
+		result = &fileHashResult{}
+		fileHashes[key] = result
+	}
+	fileHashesMutex.Unlock()
+
+	result.once.Do(func() {
+		result.hash, result.err = hash()
+	})
+	return result.hash, result.err
+}
+
+func reallyHashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns the path to the file in the provided cache directory that remembers the hash of the file
+// identified by the provided key.
+func makeHashRecordPath(cacheDir string, key fileHashKey) string {
+	id := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%d\n%d", key.path, key.size, key.modTime, key.inode)))
+	return filepath.Join(cacheDir, hashCacheDir, hex.EncodeToString(id[:16]))
+}
+
+// Write the provided hash to the provided record path. The record is written to a temporary file
+// first so that other processes never see a partial record.
+func writeHashRecord(recordPath, hash string) error {
+	if err := os.MkdirAll(filepath.Dir(recordPath), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(recordPath), cacheTmpPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.WriteString(hash)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), recordPath)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// Remove the hash records in the provided cache directory whose cache entry does not exist (a hash
+// record holds the hash of an archive, which is also the name of the cache entry that the archive is
+// unpacked into), along with temporary record files that are older than maxAge. A maxAge of 0 means
+// that temporary record files are never removed.
+func pruneHashRecords(cacheDir string, maxAge time.Duration) error {
+	recordDir := filepath.Join(cacheDir, hashCacheDir)
+	infos, err := ioutil.ReadDir(recordDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		recordPath := filepath.Join(recordDir, info.Name())
+		if strings.HasPrefix(info.Name(), cacheTmpPrefix) {
+			if maxAge == 0 || time.Since(info.ModTime()) <= maxAge {
+				continue
+			}
+		} else if contents, err := ioutil.ReadFile(recordPath); err != nil {
+			return err
+		} else if isHexHash(string(contents)) {
+			if _, err := os.Stat(makeCacheEntryPath(cacheDir, string(contents))); err == nil {
+				continue
+			}
+		}
+
+		if err := os.Remove(recordPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns true iff the provided string looks like a hex SHA-256.
+func isHexHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-hash")
+	defer os.RemoveAll(tmpDir)
+	filePath := filepath.Join(tmpDir, "release.zip")
+	mustWriteHashFile(t, filePath, "tuna")
+
+	// Parallel callers should all get the same hash, and the file should only be hashed once.
+	hashes := make([]string, 10)
+	var wg sync.WaitGroup
+	for i := range hashes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash, err := hashFile(filePath)
+			if err != nil {
+				t.Error("Could not hash file:", err)
+			}
+			hashes[i] = hash
+		}(i)
+	}
+	wg.Wait()
+
+	expected := sha256.Sum256([]byte("tuna"))
+	for _, hash := range hashes {
+		if hash != hex.EncodeToString(expected[:]) {
+			t.Errorf("Expected hash %x, got %s", expected, hash)
+		}
+	}
+	if count := countFileHashes(filePath); count != 1 {
+		t.Errorf("Expected file to be hashed once, but it was hashed %d times", count)
+	}
+
+	// Changing the file should change its hash.
+	mustWriteHashFile(t, filePath, "fish sticks")
+	hash, err := hashFile(filePath)
+	if err != nil {
+		t.Fatal("Could not hash file:", err)
+	} else if hash == hashes[0] {
+		t.Error("Expected hash to change when the file changed")
+	}
+}
+
+func TestHashFileCached(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-hash")
+	defer os.RemoveAll(tmpDir)
+	filePath := filepath.Join(tmpDir, "release.zip")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	mustWriteHashFile(t, filePath, "tuna")
+
+	hash, err := hashFileCached(filePath, cacheDir)
+	if err != nil {
+		t.Fatal("Could not hash file:", err)
+	}
+
+	key, err := makeFileHashKey(filePath)
+	if err != nil {
+		t.Fatal("Could not make hash key:", err)
+	}
+	recordPath := makeHashRecordPath(cacheDir, key)
+	if contents, err := ioutil.ReadFile(recordPath); err != nil {
+		t.Fatal("Expected hash to be recorded in the cache:", err)
+	} else if string(contents) != hash {
+		t.Errorf("Expected hash record %s, got %s", hash, contents)
+	}
+
+	// Pretend to be another process: the hash should come from the cache instead of the file.
+	fakeHash := strings.Repeat("ab", sha256.Size)
+	if err := ioutil.WriteFile(recordPath, []byte(fakeHash), 0644); err != nil {
+		t.Fatal("Could not write hash record:", err)
+	}
+	fileHashesMutex.Lock()
+	delete(fileHashes, key)
+	fileHashesMutex.Unlock()
+	if hash, err := hashFileCached(filePath, cacheDir); err != nil {
+		t.Fatal("Could not hash file:", err)
+	} else if hash != fakeHash {
+		t.Errorf("Expected hash %s from the cache, got %s", fakeHash, hash)
+	}
+
+	entries, err := ListCache(cacheDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected hash records to not show up as cache entries, got %v (error: %v)", entries, err)
+	}
+}
+
+// Returns the number of versions of the file at the provided path that have been hashed.
+func countFileHashes(path string) int {
+	path, _ = filepath.Abs(path)
+	fileHashesMutex.Lock()
+	defer fileHashesMutex.Unlock()
+
+	count := 0
+	for key := range fileHashes {
+		if key.path == path {
+			count++
+		}
+	}
+	return count
+}
+
+func mustWriteHashFile(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the inode of the provided file, so that a file that has been replaced (e.g., by git
+// checkout) is not mistaken for the old one.
+func getInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
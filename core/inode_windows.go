@@ -0,0 +1,10 @@
+package core
+
+import (
+	"os"
+)
+
+// Windows does not have inodes, so files are only told apart by their size and modification time.
+func getInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+)
+
+// Prompt represents a scripted answer to a question that an anwork command asks, e.g., the
+// confirmation that the reset command asks for. See Anwork.ExecuteInteractive.
+type Prompt struct {
+	// This is the regular expression that must match the output printed to stdout by the command
+	// (since the previous Prompt was answered) before the Answer is written to the command's stdin.
+	Regex string
+
+	// This is the answer that will be written to the command's stdin. A newline is appended to it.
+	Answer string
+}
+
+// Execute a command with an instance of an anwork package and feed the provided stdin to it. The
+// command sees EOF on its stdin once the provided reader returns EOF. Otherwise, this method is the
+// same as ExecuteContext.
+func (anwork *Anwork) ExecuteInput(ctx context.Context, stdin io.Reader, command ...string) (*RunResult, error) {
+	return anwork.execute(ctx, command, func(cmd *exec.Cmd) error {
+		cmd.Stdin = stdin
+		return nil
+	})
+}
+
+// Execute a command with an instance of an anwork package and answer the questions that it asks on
+// its stdin. The prompts are handled in order: the command's stdout is watched until the first
+// prompt's Regex matches, then its Answer is written to the command's stdin, and so on. After the
+// last prompt is answered, the command's stdin is closed. If the command exits before every prompt
+// is matched, then an error is returned that says which prompt never appeared. Otherwise, this
+// method is the same as ExecuteContext.
+func (anwork *Anwork) ExecuteInteractive(ctx context.Context, prompts []Prompt, command ...string) (*RunResult, error) {
+	watcher := &promptWatcher{prompts: prompts}
+	for _, prompt := range prompts {
+		regex, err := regexp.Compile(prompt.Regex)
+		if err != nil {
+			return nil, err
+		}
+		watcher.regexes = append(watcher.regexes, regex)
+	}
+
+	result, err := anwork.execute(ctx, command, func(cmd *exec.Cmd) error {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		watcher.stdin = stdin
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, watcher)
+		return watcher.answer()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if watcher.err != nil {
+		return nil, fmt.Errorf("Could not answer prompt for command '%s': %s", result.Command(), watcher.err)
+	} else if watcher.index < len(prompts) {
+		return nil, fmt.Errorf("Command '%s' exited before prompt '%s' appeared; stdout:\n%s",
+			result.Command(), prompts[watcher.index].Regex, result.Stdout)
+	}
+
+	return result, nil
+}
+
+// A promptWatcher is written the stdout of a command and answers its prompts as they appear.
+type promptWatcher struct {
+	prompts []Prompt
+	regexes []*regexp.Regexp
+	stdin   io.WriteCloser
+
+	// This is the index of the next prompt to be answered.
+	index int
+
+	// This is the output that has been written since the last prompt was answered.
+	output bytes.Buffer
+
+	// This is the first error that happened when answering a prompt.
+	err error
+
+	// This is true once the command's stdin has been closed.
+	closed bool
+}
+
+func (watcher *promptWatcher) Write(data []byte) (int, error) {
+	watcher.output.Write(data)
+	if watcher.err == nil {
+		watcher.err = watcher.answer()
+	}
+	return len(data), nil
+}
+
+// Answer as many prompts as have been matched by the output so far. The command's stdin is closed
+// once all of the prompts have been answered.
+func (watcher *promptWatcher) answer() error {
+	for watcher.index < len(watcher.prompts) && watcher.regexes[watcher.index].Match(watcher.output.Bytes()) {
+		watcher.output.Reset()
+		if _, err := io.WriteString(watcher.stdin, watcher.prompts[watcher.index].Answer+"\n"); err != nil {
+			return err
+		}
+		watcher.index++
+	}
+
+	if watcher.index == len(watcher.prompts) && !watcher.closed {
+		watcher.closed = true
+		return watcher.stdin.Close()
+	}
+
+	return nil
+}
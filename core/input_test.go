@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteInteractive(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestExecuteInteractive on windows because it uses shell scripts")
+	}
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-interactive")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	t.Run("Answer", func(t *testing.T) {
+		script := "printf 'Are you sure [y/n]: '\nread answer\necho \"got $answer\"\n"
+		anwork := makeScriptedAnwork(t, tmpDirPath, "answer", script)
+		prompts := []Prompt{{Regex: `\[y/n\]: $`, Answer: "y"}}
+		result, err := anwork.ExecuteInteractive(context.Background(), prompts, "reset")
+		if err != nil {
+			t.Fatal("Could not answer prompt:", err)
+		} else if err := result.Err(); err != nil {
+			t.Fatal("Expected command to succeed:", err)
+		}
+		if expected := "Are you sure [y/n]: got y\n"; result.Stdout != expected {
+			t.Errorf("Expected stdout '%s', got '%s'", expected, result.Stdout)
+		}
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		script := "printf 'name: '\nread name\nprintf 'priority: '\nread priority\necho \"$name=$priority\"\n"
+		anwork := makeScriptedAnwork(t, tmpDirPath, "order", script)
+		prompts := []Prompt{{Regex: "name: $", Answer: "task-a"}, {Regex: "priority: $", Answer: "5"}}
+		result, err := anwork.ExecuteInteractive(context.Background(), prompts, "create")
+		if err != nil {
+			t.Fatal("Could not answer prompts:", err)
+		} else if err := result.Err(); err != nil {
+			t.Fatal("Expected command to succeed:", err)
+		}
+		if !strings.HasSuffix(result.Stdout, "task-a=5\n") {
+			t.Errorf("Expected prompts to be answered in order, got '%s'", result.Stdout)
+		}
+	})
+
+	t.Run("Exit", func(t *testing.T) {
+		anwork := makeScriptedAnwork(t, tmpDirPath, "exit", "echo no questions here\n")
+		prompts := []Prompt{{Regex: "this prompt does not exist", Answer: "y"}}
+		_, err := anwork.ExecuteInteractive(context.Background(), prompts, "reset")
+		if err == nil || !strings.Contains(err.Error(), "this prompt does not exist") {
+			t.Errorf("Expected error about the missing prompt, got %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		// This script waits for an answer without ever asking the question.
+		anwork := makeScriptedAnwork(t, tmpDirPath, "timeout", "read answer\necho \"got $answer\"\n")
+		anwork.SetTimeout(100 * time.Millisecond)
+		prompts := []Prompt{{Regex: "this prompt does not exist", Answer: "y"}}
+		_, err := anwork.ExecuteInteractive(context.Background(), prompts, "reset")
+		if _, ok := err.(*TimeoutError); !ok {
+			t.Errorf("Expected a *TimeoutError, got %#v", err)
+		}
+	})
+}
+
+// Returns an Anwork instance whose binary is a shell script with the provided body, written to a
+// file with the provided name in the provided directory.
+func makeScriptedAnwork(t *testing.T, dir, name, body string) *Anwork {
+	binary := path.Join(dir, name)
+	if err := ioutil.WriteFile(binary, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal("Could not write script:", err)
+	}
+	return MustMakeAnwork(t, MajorVersion(99), WithBinary(binary))
+}
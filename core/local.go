@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// These environment variables can be used to point the test framework at a locally built anwork
+// binary instead of a release zip. See LocalBuild.
+const (
+	// This environment variable holds the path to an anwork binary that has already been built.
+	LocalBinaryEnv = "ANWORK_BINARY"
+
+	// This environment variable holds the path to an anwork checkout (e.g., submodules/anwork) that
+	// should be built with "go build".
+	LocalSourceEnv = "ANWORK_SOURCE"
+)
+
+// This is the package, relative to the root of an anwork checkout, that holds the anwork main.
+const localBuildPackage = "./cmd/anwork"
+
+// This is the regular expression used to find the version in the output of "anwork version".
+var versionRegex = regexp.MustCompile(`Version = "?(\d+(?:\.\d+){0,2}(?:-[0-9A-Za-z.-]+)?)"?`)
+
+// LocalBuild represents an anwork binary that was built locally, as opposed to one that came from
+// a release zip. This is useful for testing changes to anwork without having to package a release
+// with rollup.sh. A LocalBuild is either an existing binary (BinaryPath) or an anwork checkout that
+// should be built (SourcePath).
+//
+// When a LocalBuild is in use (see RunTests, LocalBinaryEnv, and LocalSourceEnv), MakeAnwork will
+// use the local binary for the version that the local binary reports via "anwork version". Every
+// other version will still come from the release zips.
+type LocalBuild struct {
+	// This is the path to an anwork binary that has already been built.
+	BinaryPath string
+
+	// This is the path to an anwork checkout. If BinaryPath is empty, then this checkout will be
+	// built and the resulting binary will be cached by the commit hash of the checkout.
+	SourcePath string
+
+	once    sync.Once
+	binary  string
+	version Version
+	err     error
+}
+
+// This is the LocalBuild that was configured via RunTests or the environment. It is nil if no local
+// build was requested.
+var localBuild *LocalBuild
+
+// This is the lock that guards the localBuild variable.
+var localBuildMutex sync.Mutex
+
+// Returns the LocalBuild that MakeAnwork should use, or nil if none was configured. If RunTests did
+// not set one up, then the LocalBinaryEnv and LocalSourceEnv environment variables are consulted.
+func getLocalBuild() *LocalBuild {
+	localBuildMutex.Lock()
+	defer localBuildMutex.Unlock()
+
+	if localBuild == nil {
+		localBuild = makeLocalBuild(os.Getenv(LocalBinaryEnv), os.Getenv(LocalSourceEnv))
+	}
+	return localBuild
+}
+
+func setLocalBuild(build *LocalBuild) {
+	localBuildMutex.Lock()
+	defer localBuildMutex.Unlock()
+	localBuild = build
+}
+
+// Returns a LocalBuild for the provided binary or source path, or nil if both are empty.
+func makeLocalBuild(binary, source string) *LocalBuild {
+	if binary == "" && source == "" {
+		return nil
+	}
+	return &LocalBuild{BinaryPath: binary, SourcePath: source}
+}
+
+// Returns the path to the local anwork binary, building it first if necessary, and the version that
+// the binary reports. The build only happens once per LocalBuild.
+func (build *LocalBuild) Resolve() (string, Version, error) {
+	build.once.Do(func() {
+		build.binary, build.err = build.build()
+		if build.err == nil {
+			build.version, build.err = getBinaryVersion(build.binary)
+		}
+	})
+	return build.binary, build.version, build.err
+}
+
+// A LocalBuild is also a ReleaseSource, albeit one that only has one version.
+func (build *LocalBuild) Binary(version Version) (string, error) {
+	binary, localVersion, err := build.Resolve()
+	if err != nil {
+		return "", err
+	} else if !localVersion.Equal(version) {
+		return "", fmt.Errorf("Cannot use %s (version %s) for version %s", build, localVersion, version)
+	}
+	return binary, nil
+}
+
+func (build *LocalBuild) String() string {
+	if build.BinaryPath != "" {
+		return fmt.Sprintf("local binary %s", build.BinaryPath)
+	}
+	return fmt.Sprintf("local checkout %s", build.SourcePath)
+}
+
+func (build *LocalBuild) build() (string, error) {
+	if build.BinaryPath != "" {
+		if _, err := os.Stat(build.BinaryPath); err != nil {
+			return "", err
+		}
+		return filepath.Abs(build.BinaryPath)
+	}
+
+	commit, err := getCheckoutCommit(build.SourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	binaryPath := makeLocalBuildPath(cacheDir, commit)
+
+	// A dirty checkout is rebuilt every time, since the commit hash does not describe it.
+	if !strings.HasSuffix(commit, "-dirty") {
+		if _, err := os.Stat(binaryPath); err == nil {
+			return binaryPath, touchCacheEntry(filepath.Dir(filepath.Dir(binaryPath)))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(binaryPath), os.ModeDir|os.ModePerm); err != nil {
+		return "", err
+	}
+
+	// Build into a temporary file and then rename it into place, so that other test packages that
+	// are building the same commit at the same time never see a partially written binary.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(binaryPath), "anwork-build-")
+	if err != nil {
+		return "", err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	cmd := exec.Command("go", "build", "-o", tmpFile.Name(), localBuildPackage)
+	cmd.Dir = build.SourcePath
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("Could not build anwork in %s: %s\n%s", build.SourcePath, err, output)
+	}
+
+	if err := os.Rename(tmpFile.Name(), binaryPath); err != nil {
+		return "", err
+	}
+
+	return binaryPath, nil
+}
+
+// Returns the commit hash of the provided git checkout. If the checkout has uncommitted changes,
+// then "-dirty" is appended to the hash.
+func getCheckoutCommit(source string) (string, error) {
+	output, err := exec.Command("git", "-C", source, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("Could not get commit of anwork checkout %s: %s", source, err)
+	}
+	commit := strings.TrimSpace(string(output))
+
+	output, err = exec.Command("git", "-C", source, "status", "--porcelain").Output()
+	if err != nil {
+		return "", fmt.Errorf("Could not get status of anwork checkout %s: %s", source, err)
+	}
+	if len(bytes.TrimSpace(output)) > 0 {
+		commit += "-dirty"
+	}
+
+	return commit, nil
+}
+
+func makeLocalBuildPath(cacheDir, commit string) string {
+	return filepath.Join(cacheDir, "local-"+commit, "bin", "anwork")
+}
+
+// Returns the version that the provided anwork binary reports via "anwork version".
+func getBinaryVersion(binary string) (Version, error) {
+	// Point the binary at a scratch context directory so that asking for its version does not leave
+	// a default-context file behind in the current working directory.
+	contextDir, err := ioutil.TempDir("", "anwork-version-")
+	if err != nil {
+		return Version{}, errors.New("Could not create temporary context directory: " + err.Error())
+	}
+	defer os.RemoveAll(contextDir)
+
+	output, err := exec.Command(binary, "-o", contextDir, "version").Output()
+	if err != nil {
+		return Version{}, fmt.Errorf("Could not get version of anwork binary %s: %s", binary, err)
+	}
+
+	match := versionRegex.FindSubmatch(output)
+	if match == nil {
+		return Version{}, errors.New("Could not find version in output of anwork binary: " + string(output))
+	}
+
+	return ParseVersion(string(match[1]))
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var localTestVersion = MajorVersion(42)
+
+func TestLocalBinary(t *testing.T) {
+	t.Parallel()
+
+	anwork, err := MakeAnwork(defaultVersion)
+	if err != nil {
+		t.Fatal("Failed to make anwork struct:", err)
+	}
+	defer anwork.Close()
+
+	build := &LocalBuild{BinaryPath: anwork.binaryPath}
+	binary, version, err := build.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %s", build, err)
+	}
+	if binary != anwork.binaryPath {
+		t.Errorf("Expected binary %s, got %s", anwork.binaryPath, binary)
+	}
+	if !version.Equal(defaultVersion) {
+		t.Errorf("Expected version %s, got %s", defaultVersion, version)
+	}
+
+	build = &LocalBuild{BinaryPath: "this/path/does/not/exist"}
+	if _, _, err := build.Resolve(); err == nil {
+		t.Error("Expected an error from resolving a missing binary")
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	for _, tool := range []string{"git", "go"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("Skipping TestLocalSource because %s is not installed", tool)
+		}
+	}
+
+	source := makeFakeCheckout(t)
+	defer os.RemoveAll(source)
+
+	commit, err := getCheckoutCommit(source)
+	if err != nil {
+		t.Fatal("Failed to get commit of fake checkout:", err)
+	}
+	cacheDir, err := CacheDir()
+	if err != nil {
+		t.Fatal("Could not get cache directory:", err)
+	}
+	defer os.RemoveAll(path.Dir(path.Dir(makeLocalBuildPath(cacheDir, commit))))
+
+	build := &LocalBuild{SourcePath: source}
+	binary, version, err := build.Resolve()
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %s", build, err)
+	}
+	t.Logf("Built %s at %s (version %s)", build, binary, version)
+	if !version.Equal(localTestVersion) {
+		t.Errorf("Expected version %s, got %s", localTestVersion, version)
+	}
+
+	// A second build of the same commit should come from the cache.
+	info, err := os.Stat(binary)
+	if err != nil {
+		t.Fatal("Could not stat binary:", err)
+	}
+	otherBinary, _, err := (&LocalBuild{SourcePath: source}).Resolve()
+	if err != nil {
+		t.Fatal("Failed to resolve local build for the second time:", err)
+	}
+	otherInfo, err := os.Stat(otherBinary)
+	if err != nil {
+		t.Fatal("Could not stat binary:", err)
+	}
+	if binary != otherBinary || !info.ModTime().Equal(otherInfo.ModTime()) {
+		t.Errorf("Expected cached binary %s to be reused, got %s", binary, otherBinary)
+	}
+
+	// MakeAnwork should use the local build for its version, and the releases for everything else.
+	setLocalBuild(build)
+	defer setLocalBuild(nil)
+	anwork, err := MakeAnwork(localTestVersion)
+	if err != nil {
+		t.Fatal("Failed to make anwork struct from local build:", err)
+	}
+	defer anwork.Close()
+	if anwork.binaryPath != binary {
+		t.Errorf("Expected anwork struct to use %s, got %s", binary, anwork.binaryPath)
+	}
+	if _, err := MakeAnwork(MajorVersion(65535)); err == nil {
+		t.Error("Should have received an error from bad anwork version!")
+	}
+}
+
+// Make a git checkout with a fake anwork main package in it that only knows how to print its
+// version.
+func makeFakeCheckout(t *testing.T) string {
+	source, err := ioutil.TempDir("", "anwork-source")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+
+	files := map[string]string{
+		"go.mod": "module github.com/ankeesler/anwork\n",
+		"cmd/anwork/main.go": strings.Join([]string{
+			"package main",
+			"import \"fmt\"",
+			"func main() { fmt.Println(\"ANWORK Version = 42\") }",
+		}, "\n"),
+	}
+	for name, contents := range files {
+		filePath := filepath.Join(source, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+			t.Fatal("Could not create directory:", err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(contents), 0644); err != nil {
+			t.Fatal("Could not write file:", err)
+		}
+	}
+
+	commands := [][]string{
+		[]string{"init", "-q"},
+		[]string{"add", "."},
+		[]string{"-c", "user.name=anwork", "-c", "user.email=anwork@example.com", "commit", "-q", "-m", "Fake."},
+	}
+	for _, command := range commands {
+		cmd := exec.Command("git", command...)
+		cmd.Dir = source
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Could not run git %s: %s\n%s", command, err, output)
+		}
+	}
+
+	return source
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// A fileLock is an exclusive lock on a file that is shared across processes.
+type fileLock struct {
+	file *os.File
+}
+
+// Take an exclusive lock on the provided path, creating the file if it does not exist. This
+// function blocks until the lock is available.
+//
+// Whoever holds the lock is allowed to remove the file (see PruneCache), so once the lock is taken we
+// make sure that the file we locked is still the one at the provided path, and try again if not.
+func lockFile(path string) (*fileLock, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if pathInfo, err := os.Stat(path); err == nil && os.SameFile(fileInfo, pathInfo) {
+			return &fileLock{file: file}, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			file.Close()
+			return nil, err
+		}
+
+		file.Close()
+	}
+}
+
+func (lock *fileLock) unlock() error {
+	// Closing the file releases the lock.
+	return lock.file.Close()
+}
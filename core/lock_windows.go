@@ -0,0 +1,37 @@
+package core
+
+import (
+	"os"
+	"time"
+)
+
+// A fileLock is an exclusive lock on a file that is shared across processes.
+type fileLock struct {
+	path string
+}
+
+// Take an exclusive lock on the provided path. This function blocks until the lock is available.
+//
+// The syscall package does not give us a way to lock a file on windows, so the lock is held by
+// whoever manages to create the file. A lock file that is older than a minute is assumed to belong
+// to a process that crashed.
+func lockFile(path string) (*fileLock, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		if err == nil {
+			file.Close()
+			return &fileLock{path: path}, nil
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (lock *fileLock) unlock() error {
+	return os.Remove(lock.path)
+}
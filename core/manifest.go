@@ -0,0 +1,208 @@
+package core
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// This is the name of the manifest file that lives next to a release archive, e.g.,
+// release/v2/MANIFEST. See Manifest.
+const ManifestName = "MANIFEST"
+
+// This is the comment at the top of every manifest file.
+const manifestHeader = "# This file was generated by anworkmanifest; do not edit it by hand."
+
+// Manifest records the SHA-256 of a release archive and of every file inside of it, so that a
+// corrupt or accidentally changed release can be detected before it is used. A manifest file looks
+// like this.
+//
+//	archive <sha256> anwork-2.zip
+//	file <sha256> anwork-2/bin/anwork
+//	file <sha256> anwork-2/bin/anwork_linux_amd64
+//	...
+type Manifest struct {
+	// This is the base name of the release archive.
+	ArchiveName string
+	// This is the hex SHA-256 of the release archive.
+	ArchiveHash string
+	// This maps the name of every regular file in the release archive to its hex SHA-256.
+	Files map[string]string
+}
+
+// Make a Manifest for the release archive at the provided path.
+func MakeManifest(archivePath string) (*Manifest, error) {
+	archiveHash, err := hashFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		ArchiveName: filepath.Base(archivePath),
+		ArchiveHash: archiveHash,
+		Files:       map[string]string{},
+	}
+	err = walkArchive(archivePath, func(entry *archiveEntry) error {
+		if !entry.Info.Mode().IsRegular() {
+			return nil
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, entry.Reader); err != nil {
+			return err
+		}
+		manifest.Files[entry.Name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Read the manifest file at the provided path.
+func ReadManifest(manifestPath string) (*Manifest, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := &Manifest{Files: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || len(fields[1]) != sha256.Size*2 {
+			return nil, fmt.Errorf("Invalid line %d in manifest %s: '%s'", lineNumber, manifestPath, line)
+		}
+		switch fields[0] {
+		case "archive":
+			manifest.ArchiveName, manifest.ArchiveHash = fields[2], fields[1]
+		case "file":
+			manifest.Files[fields[2]] = fields[1]
+		default:
+			return nil, fmt.Errorf("Invalid line %d in manifest %s: '%s'", lineNumber, manifestPath, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if manifest.ArchiveName == "" {
+		return nil, fmt.Errorf("Manifest %s does not have an archive line", manifestPath)
+	}
+	return manifest, nil
+}
+
+// Write this manifest to the provided file path.
+func (manifest *Manifest) WriteFile(manifestPath string) error {
+	file, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintln(writer, manifestHeader)
+	fmt.Fprintf(writer, "archive %s %s\n", manifest.ArchiveHash, manifest.ArchiveName)
+	for _, name := range manifest.fileNames() {
+		fmt.Fprintf(writer, "file %s %s\n", manifest.Files[name], name)
+	}
+
+	err = writer.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Returns an error if the release archive at the provided path does not have the SHA-256 that is
+// recorded in this manifest.
+func (manifest *Manifest) VerifyArchive(archivePath string) error {
+	hash, err := hashFile(archivePath)
+	if err != nil {
+		return err
+	}
+	return manifest.verifyArchiveHash(archivePath, hash)
+}
+
+// This is the same as VerifyArchive, except that the provided hash of the archive is used.
+func (manifest *Manifest) verifyArchiveHash(archivePath, hash string) error {
+	if name := filepath.Base(archivePath); name != manifest.ArchiveName {
+		return fmt.Errorf("Release archive %s is not %s from its manifest", archivePath, manifest.ArchiveName)
+	}
+	if hash != manifest.ArchiveHash {
+		return fmt.Errorf("Release archive %s has SHA-256 %s, but its manifest says %s; "+
+			"the archive is corrupt or was changed without updating the manifest",
+			archivePath, hash, manifest.ArchiveHash)
+	}
+	return nil
+}
+
+// Returns an error describing every file in this manifest that is missing from the provided
+// unpacked release, or that has a different SHA-256 than the one that is recorded in the manifest.
+func (manifest *Manifest) VerifyTree(root string) error {
+	problems := []string{}
+	for _, name := range manifest.fileNames() {
+		hash, err := hashFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if hash != manifest.Files[name] {
+			problems = append(problems, fmt.Sprintf("%s has SHA-256 %s, expected %s", name, hash, manifest.Files[name]))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Release %s does not match manifest for %s:\n  %s",
+			root, manifest.ArchiveName, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Returns the names of the files in this manifest in sorted order.
+func (manifest *Manifest) fileNames() []string {
+	names := make([]string, 0, len(manifest.Files))
+	for name := range manifest.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the manifest for the release archive at the provided path, i.e., the MANIFEST file in the
+// same directory, or nil if there is none. A manifest that is for a different archive (e.g., the
+// zip version of a tar.gz release) does not count. If the manifest is required, then an error is
+// returned instead of nil, since the release archive cannot be verified.
+func findManifest(archivePath string, required bool) (*Manifest, error) {
+	manifestPath := filepath.Join(filepath.Dir(archivePath), ManifestName)
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		if required {
+			return nil, fmt.Errorf("Cannot verify release archive %s because there is no %s next to it",
+				archivePath, ManifestName)
+		}
+		return nil, nil
+	}
+
+	manifest, err := ReadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.ArchiveName != filepath.Base(archivePath) {
+		if required {
+			return nil, fmt.Errorf("Cannot verify release archive %s because %s is for %s",
+				archivePath, manifestPath, manifest.ArchiveName)
+		}
+		return nil, nil
+	}
+	return manifest, nil
+}
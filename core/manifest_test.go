@@ -0,0 +1,214 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	manifest, err := MakeManifest(testZipPath)
+	if err != nil {
+		t.Fatal("Could not make manifest:", err)
+	}
+	if manifest.ArchiveName != "test.zip" || len(manifest.ArchiveHash) != 64 || len(manifest.Files) != 5 {
+		t.Errorf("Unexpected manifest: %#v", manifest)
+	}
+
+	tmpDir := mustMakeTmpDir(t, "anwork-manifest")
+	defer os.RemoveAll(tmpDir)
+	manifestPath := filepath.Join(tmpDir, ManifestName)
+	if err := manifest.WriteFile(manifestPath); err != nil {
+		t.Fatal("Could not write manifest:", err)
+	}
+	readManifest, err := ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatal("Could not read manifest:", err)
+	}
+	if !reflect.DeepEqual(manifest, readManifest) {
+		t.Errorf("Expected manifest %#v, read %#v", manifest, readManifest)
+	}
+
+	if err := manifest.VerifyArchive(testZipPath); err != nil {
+		t.Error("Expected archive to match its manifest:", err)
+	}
+}
+
+func TestManifestMismatch(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-manifest")
+	defer os.RemoveAll(tmpDir)
+
+	// Write a manifest for one archive, and then replace the archive with another one.
+	archivePath := filepath.Join(tmpDir, "test.zip")
+	mustCopyFile(t, testZipPath, archivePath)
+	manifest, err := MakeManifest(archivePath)
+	if err != nil {
+		t.Fatal("Could not make manifest:", err)
+	}
+	if err := manifest.WriteFile(filepath.Join(tmpDir, ManifestName)); err != nil {
+		t.Fatal("Could not write manifest:", err)
+	}
+	mustCopyFile(t, otherTestZipPath, archivePath)
+
+	source := &ArchiveSource{Path: archivePath, CacheDir: filepath.Join(tmpDir, "cache")}
+	_, err = source.Binary(defaultVersion)
+	if err == nil {
+		t.Fatal("Expected error from release archive that does not match its manifest")
+	} else if !strings.Contains(err.Error(), "SHA-256") {
+		t.Errorf("Expected error to mention SHA-256, got '%s'", err)
+	}
+
+	// An unpacked release that has been changed should also be caught.
+	mustCopyFile(t, testZipPath, archivePath)
+	treePath := filepath.Join(tmpDir, "tree")
+	if err := extractArchive(archivePath, treePath); err != nil {
+		t.Fatal("Could not extract archive:", err)
+	}
+	if err := manifest.VerifyTree(treePath); err != nil {
+		t.Error("Expected unpacked release to match its manifest:", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(treePath, "test", "file-2"), []byte("oops"), 0644); err != nil {
+		t.Fatal("Could not change unpacked release:", err)
+	}
+	if err := manifest.VerifyTree(treePath); err == nil || !strings.Contains(err.Error(), "test/file-2") {
+		t.Errorf("Expected error about test/file-2, got %v", err)
+	}
+}
+
+func TestManifestRequired(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-manifest")
+	defer os.RemoveAll(tmpDir)
+
+	releaseDir := filepath.Join(tmpDir, "release")
+	archivePath := filepath.Join(releaseDir, "v7", "anwork-7.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(archivePath), os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create release directory:", err)
+	}
+	writeFakeTarball(t, archivePath, 7)
+	manifestPath := filepath.Join(filepath.Dir(archivePath), ManifestName)
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if err := os.Mkdir(cacheDir, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create cache directory:", err)
+	}
+
+	// A release directory archive without a manifest is refused...
+	dir := &DirSource{Path: releaseDir}
+	if _, err := dir.Binary(MajorVersion(7)); err == nil || !strings.Contains(err.Error(), "no MANIFEST") {
+		t.Errorf("Expected error about missing manifest, got %v", err)
+	}
+
+	// ...and so is one whose manifest is for a different archive...
+	manifest, err := MakeManifest(archivePath)
+	if err != nil {
+		t.Fatal("Could not make manifest:", err)
+	}
+	manifest.ArchiveName = "anwork-7.zip"
+	if err := manifest.WriteFile(manifestPath); err != nil {
+		t.Fatal("Could not write manifest:", err)
+	}
+	if _, err := dir.Binary(MajorVersion(7)); err == nil || !strings.Contains(err.Error(), "is for anwork-7.zip") {
+		t.Errorf("Expected error about manifest for another archive, got %v", err)
+	}
+
+	// ...unless verification is explicitly skipped.
+	archive := &ArchiveSource{Path: archivePath, CacheDir: cacheDir, RequireManifest: true, SkipVerification: true}
+	if _, err := archive.Binary(MajorVersion(7)); err != nil {
+		t.Error("Expected no error when skipping verification, got", err)
+	}
+
+	// An archive that is not in a release directory does not need a manifest.
+	archive = &ArchiveSource{Path: archivePath, CacheDir: cacheDir}
+	if _, err := archive.Binary(MajorVersion(7)); err != nil {
+		t.Error("Expected no error from archive without a required manifest, got", err)
+	}
+
+	manifest.ArchiveName = filepath.Base(archivePath)
+	if err := manifest.WriteFile(manifestPath); err != nil {
+		t.Fatal("Could not write manifest:", err)
+	}
+	archive = &ArchiveSource{Path: archivePath, CacheDir: cacheDir, RequireManifest: true}
+	if _, err := archive.Binary(MajorVersion(7)); err != nil {
+		t.Error("Expected no error from archive with a matching manifest, got", err)
+	}
+}
+
+func TestManifestRepairsCache(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestManifestRepairsCache on windows because it uses a shell script")
+	}
+
+	tmpDir := mustMakeTmpDir(t, "anwork-manifest")
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "anwork-7.tar.gz")
+	writeFakeTarball(t, archivePath, 7)
+	manifest, err := MakeManifest(archivePath)
+	if err != nil {
+		t.Fatal("Could not make manifest:", err)
+	}
+	if err := manifest.WriteFile(filepath.Join(tmpDir, ManifestName)); err != nil {
+		t.Fatal("Could not write manifest:", err)
+	}
+	cacheDir := filepath.Join(tmpDir, "cache")
+	if err := os.Mkdir(cacheDir, os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create cache directory:", err)
+	}
+
+	source := &ArchiveSource{Path: archivePath, CacheDir: cacheDir, RequireManifest: true}
+	binary, err := source.Binary(MajorVersion(7))
+	if err != nil {
+		t.Fatal("Could not get binary:", err)
+	}
+
+	// Corrupt the binary in the cache; the next Binary call should unpack the archive again.
+	if err := ioutil.WriteFile(binary, []byte("#!/bin/sh\necho corrupt\n"), 0755); err != nil {
+		t.Fatal("Could not corrupt cached binary:", err)
+	}
+	if binary, err = source.Binary(MajorVersion(7)); err != nil {
+		t.Fatal("Expected Binary to recover from a corrupt cache entry, got", err)
+	}
+	checkFakeBinary(t, binary, "ANWORK Version = 7\n")
+}
+
+func TestReadBadManifest(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-manifest")
+	defer os.RemoveAll(tmpDir)
+
+	data := []string{
+		"",
+		"file 0123 anwork-2/bin/anwork\n",
+		"archive " + strings.Repeat("0", 64) + "\nfoo " + strings.Repeat("0", 64) + " bar\n",
+	}
+	for _, contents := range data {
+		manifestPath := filepath.Join(tmpDir, ManifestName)
+		if err := ioutil.WriteFile(manifestPath, []byte(contents), 0644); err != nil {
+			t.Fatal("Could not write manifest:", err)
+		}
+		if _, err := ReadManifest(manifestPath); err == nil {
+			t.Errorf("Expected error from reading manifest '%s'", contents)
+		}
+	}
+}
+
+func mustCopyFile(t *testing.T, from, to string) {
+	contents, err := ioutil.ReadFile(from)
+	if err != nil {
+		t.Fatal("Could not read file:", err)
+	}
+	if err := ioutil.WriteFile(to, contents, 0644); err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+}
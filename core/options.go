@@ -0,0 +1,138 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Logger is something that can log messages, e.g., a *testing.T.
+type Logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// Option configures an Anwork instance. Options are passed to MakeAnwork.
+type Option func(*options)
+
+// This is the configuration that is built up by a list of Option's.
+type options struct {
+	env           []string
+	binary        string
+	workingDir    string
+	contextDir    string
+	contextRoot   string
+	fixture       string
+	timeout       time.Duration
+	logger        Logger
+	tb            testing.TB
+	keepOnFailure bool
+	validate      bool
+}
+
+func makeOptions(opts []Option) *options {
+	o := &options{
+		timeout:       DefaultTimeout,
+		keepOnFailure: os.Getenv(KeepContextEnv) != "",
+		validate:      os.Getenv(ValidateEnv) != "",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Add environment variables, in "KEY=VALUE" form, to the environment of every command run by the
+// Anwork instance. The rest of the environment is inherited from the test process. If a variable
+// is set more than once, the last value wins.
+func WithEnv(env ...string) Option {
+	return func(o *options) {
+		o.env = append(o.env, env...)
+	}
+}
+
+// Use the anwork binary at the provided path instead of the one for the version passed to MakeAnwork
+// (i.e., the ReleaseSource and LocalBuild are not consulted).
+func WithBinary(path string) Option {
+	return func(o *options) {
+		o.binary = path
+	}
+}
+
+// Run every command in the provided working directory. By default, commands are run in the current
+// working directory of the test process, i.e., the test package directory.
+func WithWorkingDir(dir string) Option {
+	return func(o *options) {
+		o.workingDir = dir
+	}
+}
+
+// Use the provided directory as the context directory for the Anwork instance. The directory does
+// not need to exist. Since the caller owns this directory, it will not be deleted when the Anwork
+// instance is closed. By default, a new temporary context directory is created (and deleted) for
+// every Anwork instance.
+func WithContextDir(dir string) Option {
+	return func(o *options) {
+		o.contextDir = dir
+	}
+}
+
+// Seed the Anwork instance with the provided context file (e.g., v2/data/default-context), so that
+// the first command sees a known state. The file is copied into the context directory as the
+// default context when the Anwork instance is made; the fixture itself is never modified.
+func WithFixture(path string) Option {
+	return func(o *options) {
+		o.fixture = path
+	}
+}
+
+// Create the context directory for the Anwork instance in the provided root directory, instead of in
+// the default one (see ContextRoot). This has no effect if WithContextDir is used.
+func WithContextRoot(root string) Option {
+	return func(o *options) {
+		o.contextRoot = root
+	}
+}
+
+// Close the Anwork instance when the provided test (or benchmark) finishes, via t.Cleanup, so that
+// its context directory is deleted even if the test never calls Anwork.Close. The context directory
+// is also named after the test. MustMakeAnwork uses this option.
+func WithCleanup(t testing.TB) Option {
+	return func(o *options) {
+		o.tb = t
+	}
+}
+
+// Leave the context directory of the Anwork instance in place if the test that was passed to
+// WithCleanup fails, so that it can be inspected; its path is logged to the test. Anwork.Close does
+// not delete the context directory in this mode; it is deleted when the test passes. This is on by
+// default when the KeepContextEnv environment variable is set.
+func WithKeepOnFailure(keep bool) Option {
+	return func(o *options) {
+		o.keepOnFailure = keep
+	}
+}
+
+// Validate every context file in the context directory of the Anwork instance (see
+// anworkcontext.State.Validate) after each command, so that a command that corrupts a context fails
+// with an *InvalidContextError instead of making a later command fail in an odd way. This is on by
+// default when the ValidateEnv environment variable is set.
+func WithValidation(validate bool) Option {
+	return func(o *options) {
+		o.validate = validate
+	}
+}
+
+// Set the amount of time that a single command is allowed to run on the Anwork instance. See
+// Anwork.SetTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Log every command run by the Anwork instance, and its result, to the provided Logger.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
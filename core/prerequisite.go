@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// RuntimeType is the kind of program that an anwork binary is, which determines what needs to be
+// installed on the test machine in order to run it.
+type RuntimeType int
+
+const (
+	// A native executable, e.g., bin/anwork_linux_amd64 or a local build. It needs nothing else.
+	NativeRuntime RuntimeType = iota
+	// The bin/anwork script from a multi-platform release, which runs "go env" to pick the binary
+	// for the platform. It needs Go (unless GOOS and GOARCH are set) and a binary for the platform.
+	GoWrapperRuntime
+	// The bin/anwork start script from a Java release (e.g., version 1), which runs the jars in the
+	// release's lib directory. It needs a Java runtime.
+	JVMRuntime
+)
+
+func (runtimeType RuntimeType) String() string {
+	switch runtimeType {
+	case NativeRuntime:
+		return "native"
+	case GoWrapperRuntime:
+		return "go wrapper"
+	case JVMRuntime:
+		return "jvm"
+	default:
+		return fmt.Sprintf("RuntimeType(%d)", int(runtimeType))
+	}
+}
+
+// ErrPrerequisiteMissing is returned from MakeAnwork when the anwork binary for a version cannot be
+// run on this machine because something that it needs is not installed, e.g., Java for version 1.
+// Tests should skip instead of fail when they get this error; see MustMakeAnwork.
+type ErrPrerequisiteMissing struct {
+	// This is the anwork binary that cannot be run.
+	Binary string
+	// This is the kind of program that the anwork binary is.
+	Runtime RuntimeType
+	// This is the thing that is missing, e.g., "java".
+	Prerequisite string
+	// This describes why the prerequisite is considered missing.
+	Reason string
+}
+
+func (err *ErrPrerequisiteMissing) Error() string {
+	return fmt.Sprintf("Cannot run %s (%s runtime) because %s is missing: %s", err.Binary, err.Runtime,
+		err.Prerequisite, err.Reason)
+}
+
+// This is how many bytes of a binary are read to figure out its RuntimeType.
+const runtimeSniffSize = 4096
+
+// Returns the RuntimeType of the provided anwork binary. Scripts are recognized by what they run;
+// anything else is considered native.
+func detectRuntime(binary string) (RuntimeType, error) {
+	file, err := os.Open(binary)
+	if err != nil {
+		return NativeRuntime, err
+	}
+	defer file.Close()
+
+	header := make([]byte, runtimeSniffSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return NativeRuntime, err
+	}
+	header = header[:n]
+
+	if !bytes.HasPrefix(header, []byte("#!")) {
+		return NativeRuntime, nil
+	}
+	if jars, _ := filepath.Glob(filepath.Join(filepath.Dir(binary), "..", "lib", "*.jar")); len(jars) > 0 ||
+		bytes.Contains(header, []byte("JAVACMD")) {
+		return JVMRuntime, nil
+	}
+	if bytes.Contains(header, []byte("go env")) {
+		return GoWrapperRuntime, nil
+	}
+	return NativeRuntime, nil
+}
+
+// Returns an *ErrPrerequisiteMissing if the provided anwork binary cannot be run with the provided
+// environment (in the os.Environ format, where later entries win), or some other error if the
+// binary cannot be inspected.
+func checkPrerequisites(binary string, env []string) error {
+	runtimeType, err := detectRuntime(binary)
+	if err != nil {
+		return err
+	}
+
+	missing := func(prerequisite, reason string) error {
+		return &ErrPrerequisiteMissing{
+			Binary:       binary,
+			Runtime:      runtimeType,
+			Prerequisite: prerequisite,
+			Reason:       reason,
+		}
+	}
+
+	switch runtimeType {
+	case JVMRuntime:
+		if javaHome := getEnv(env, "JAVA_HOME"); javaHome != "" {
+			java := filepath.Join(javaHome, "bin", "java")
+			if info, err := os.Stat(java); err != nil || !isExecutable(info) {
+				return missing("java", "JAVA_HOME is set to "+javaHome+", but it has no bin/java")
+			}
+		} else if _, ok := lookPath("java", getEnv(env, "PATH")); !ok {
+			return missing("java", "JAVA_HOME is not set and there is no java on the PATH")
+		}
+
+	case GoWrapperRuntime:
+		goos, goarch := getEnv(env, "GOOS"), getEnv(env, "GOARCH")
+		if goos == "" || goarch == "" {
+			if _, ok := lookPath("go", getEnv(env, "PATH")); !ok {
+				return missing("go", "the script runs 'go env' to find the platform, but there is no go "+
+					"on the PATH (set GOOS and GOARCH to avoid it)")
+			}
+		}
+		if goos == "" {
+			goos = runtime.GOOS
+		}
+		if goarch == "" {
+			goarch = runtime.GOARCH
+		}
+		name := platformBinaryName(goos, goarch)
+		if _, err := os.Stat(filepath.Join(filepath.Dir(binary), name)); err != nil {
+			return missing(name, fmt.Sprintf("the release has no binary for %s/%s", goos, goarch))
+		}
+	}
+
+	return nil
+}
+
+// Returns the value of the provided variable in the provided environment (in the os.Environ format),
+// falling back to the environment of this process.
+func getEnv(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], name+"=") {
+			return strings.TrimPrefix(env[i], name+"=")
+		}
+	}
+	return os.Getenv(name)
+}
+
+// This is like exec.LookPath, except that it searches the provided PATH value instead of the one in
+// the environment of this process.
+func lookPath(name, path string) (string, bool) {
+	names := []string{name}
+	if runtime.GOOS == "windows" {
+		names = append(names, name+".exe")
+	}
+	for _, dir := range filepath.SplitList(path) {
+		for _, name := range names {
+			candidate := filepath.Join(dir, name)
+			if info, err := os.Stat(candidate); err == nil && isExecutable(info) {
+				return candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// This is like MakeAnwork, except that it skips the provided test (or benchmark) if the anwork
+// binary for the version cannot be run on this machine (see ErrPrerequisiteMissing), and fails it
+// if anything else goes wrong. The Anwork instance is closed when the test finishes (see
+// WithCleanup).
+func MustMakeAnwork(t testing.TB, version Version, opts ...Option) *Anwork {
+	t.Helper()
+	anwork, err := MakeAnwork(version, append([]Option{WithCleanup(t)}, opts...)...)
+	var missing *ErrPrerequisiteMissing
+	if errors.As(err, &missing) {
+		t.Skipf("Skipping because anwork %s cannot run here: %s", version, missing)
+	} else if err != nil {
+		t.Fatal("Cannot make anwork:", err)
+	}
+	return anwork
+}
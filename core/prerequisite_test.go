@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-runtime")
+	defer os.RemoveAll(tmpDir)
+
+	jvmRoot := filepath.Join(tmpDir, "jvm")
+	mustWriteExecutable(t, filepath.Join(jvmRoot, "bin", "anwork"), "#!/usr/bin/env sh\nexec \"$JAVACMD\" \"$@\"\n")
+	mustWriteExecutable(t, filepath.Join(jvmRoot, "lib", "anwork-1.jar"), "jar")
+	wrapperRoot := filepath.Join(tmpDir, "wrapper")
+	mustWriteExecutable(t, filepath.Join(wrapperRoot, "bin", "anwork"), "#!/bin/sh\nGOOS=`go env GOOS`\n")
+	nativeRoot := filepath.Join(tmpDir, "native")
+	mustWriteExecutable(t, filepath.Join(nativeRoot, "bin", "anwork"), "\x7fELF...")
+
+	data := []struct {
+		root    string
+		runtime RuntimeType
+	}{
+		{jvmRoot, JVMRuntime},
+		{wrapperRoot, GoWrapperRuntime},
+		{nativeRoot, NativeRuntime},
+	}
+	for _, d := range data {
+		runtimeType, err := detectRuntime(filepath.Join(d.root, "bin", "anwork"))
+		if err != nil {
+			t.Errorf("Could not detect runtime of %s: %s", d.root, err)
+		} else if runtimeType != d.runtime {
+			t.Errorf("Expected %s to have runtime %s, got %s", d.root, d.runtime, runtimeType)
+		}
+	}
+}
+
+func TestCheckPrerequisites(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := mustMakeTmpDir(t, "anwork-runtime")
+	defer os.RemoveAll(tmpDir)
+
+	jvmBinary := filepath.Join(tmpDir, "jvm", "bin", "anwork")
+	mustWriteExecutable(t, jvmBinary, "#!/usr/bin/env sh\nexec \"$JAVACMD\" \"$@\"\n")
+	javaHome := filepath.Join(tmpDir, "java")
+	mustWriteExecutable(t, filepath.Join(javaHome, "bin", "java"), "#!/bin/sh\n")
+
+	wrapperBinary := filepath.Join(tmpDir, "wrapper", "bin", "anwork")
+	mustWriteExecutable(t, wrapperBinary, "#!/bin/sh\nGOOS=`go env GOOS`\n")
+	mustWriteExecutable(t, filepath.Join(tmpDir, "wrapper", "bin", platformBinaryName("plan9", "386")), "plan9")
+
+	emptyPath := "PATH=" + filepath.Join(tmpDir, "empty")
+	data := []struct {
+		binary       string
+		env          []string
+		prerequisite string // empty if nothing is missing
+	}{
+		{jvmBinary, []string{emptyPath, "JAVA_HOME="}, "java"},
+		{jvmBinary, []string{emptyPath, "JAVA_HOME=" + filepath.Join(tmpDir, "nope")}, "java"},
+		{jvmBinary, []string{emptyPath, "JAVA_HOME=" + javaHome}, ""},
+		{jvmBinary, []string{"PATH=" + filepath.Join(javaHome, "bin"), "JAVA_HOME="}, ""},
+		{wrapperBinary, []string{emptyPath, "GOOS=", "GOARCH="}, "go"},
+		{wrapperBinary, []string{emptyPath, "GOOS=plan9", "GOARCH=386"}, ""},
+		{wrapperBinary, []string{emptyPath, "GOOS=plan9", "GOARCH=arm"}, platformBinaryName("plan9", "arm")},
+	}
+	for i, d := range data {
+		err := checkPrerequisites(d.binary, d.env)
+		var missing *ErrPrerequisiteMissing
+		if d.prerequisite == "" {
+			if err != nil {
+				t.Errorf("%d: expected no missing prerequisites, got %s", i, err)
+			}
+		} else if !errors.As(err, &missing) {
+			t.Errorf("%d: expected *ErrPrerequisiteMissing, got %v", i, err)
+		} else if missing.Prerequisite != d.prerequisite {
+			t.Errorf("%d: expected %s to be missing, got %s", i, d.prerequisite, missing)
+		}
+	}
+}
+
+func TestMustMakeAnworkSkips(t *testing.T) {
+	t.Parallel()
+
+	// Java cannot be found if JAVA_HOME points nowhere, whether or not it is installed.
+	recorder := &skipRecorder{TB: t}
+	anwork := MustMakeAnwork(recorder, MajorVersion(1), WithEnv("JAVA_HOME=/this/path/does/not/exist"))
+	if anwork != nil {
+		anwork.Close()
+		t.Fatal("Expected MustMakeAnwork to not return an Anwork instance")
+	} else if recorder.skipped == "" {
+		t.Fatal("Expected MustMakeAnwork to skip the test")
+	}
+	t.Logf("MustMakeAnwork skipped with '%s'", recorder.skipped)
+}
+
+// This is a testing.TB that records calls to Skipf instead of skipping.
+type skipRecorder struct {
+	testing.TB
+	skipped string
+}
+
+func (recorder *skipRecorder) Skipf(format string, args ...interface{}) {
+	recorder.skipped = fmt.Sprintf(format, args...)
+}
+
+func mustWriteExecutable(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create directory:", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0755); err != nil {
+		t.Fatal("Could not write file:", err)
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(path, 0755); err != nil {
+			t.Fatal("Could not chmod file:", err)
+		}
+	}
+}
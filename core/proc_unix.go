@@ -0,0 +1,19 @@
+//go:build !windows
+
+package core
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Put the command's process into its own process group so that killProcessGroup can kill the
+// command and everything that it spawned (e.g., the go env call in the bin/anwork wrapper).
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	// A negative pid means the whole process group.
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
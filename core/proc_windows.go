@@ -0,0 +1,13 @@
+package core
+
+import (
+	"os/exec"
+)
+
+// Windows does not have process groups in the unix sense, so we just kill the command itself.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
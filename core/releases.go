@@ -0,0 +1,208 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// This is the regular expression that matches the name of a release archive, e.g., anwork-2.zip.
+var releaseArchiveRegex = regexp.MustCompile(`^anwork-(.+?)(\.zip|\.tar\.gz|\.tgz)$`)
+
+// This is the regular expression that matches the name of a platform specific binary in the bin
+// directory of a release, e.g., anwork_linux_amd64.
+var platformBinaryRegex = regexp.MustCompile(`^anwork_([a-z0-9]+)_([a-z0-9]+)(\.exe)?$`)
+
+// Release describes an anwork release that is available to the tests. See release/README for how a
+// release is laid out.
+type Release struct {
+	// This is the version of the release.
+	Version Version
+	// This is the path to the release archive.
+	ArchivePath string
+	// This is the hex SHA-256 of the release archive.
+	Hash string
+	// This is the size of the release archive in bytes.
+	Size int64
+	// These are the platforms that the release has binaries for, in GOOS/GOARCH form (e.g.,
+	// "linux/amd64"). It is empty if the release only has the bin/anwork executable.
+	Platforms []string
+	// These are the documentation files in the release, relative to the release root (e.g.,
+	// "doc/CLI.md").
+	Docs []string
+}
+
+func (release *Release) String() string {
+	return fmt.Sprintf("anwork %s (%s, %d bytes, platforms: %s)", release.Version, release.ArchivePath,
+		release.Size, strings.Join(release.Platforms, " "))
+}
+
+// Returns true iff this release has a binary for the provided GOOS/GOARCH platform.
+func (release *Release) HasPlatform(platform string) bool {
+	for _, p := range release.Platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseList is a list of releases that is sorted by version (see Version.Compare).
+type ReleaseList []*Release
+
+// Returns the release with the highest version, or nil if the list is empty.
+func (releases ReleaseList) Latest() *Release {
+	if len(releases) == 0 {
+		return nil
+	}
+	return releases[len(releases)-1]
+}
+
+// Returns the releases whose versions are between min and max, inclusive.
+func (releases ReleaseList) Range(min, max Version) ReleaseList {
+	inRange := ReleaseList{}
+	for _, release := range releases {
+		if release.Version.AtLeast(min) && max.AtLeast(release.Version) {
+			inRange = append(inRange, release)
+		}
+	}
+	return inRange
+}
+
+// Returns the release with the provided version, or nil if there is no such release.
+func (releases ReleaseList) Get(version Version) *Release {
+	for _, release := range releases {
+		if release.Version.Equal(version) {
+			return release
+		}
+	}
+	return nil
+}
+
+// Returns the versions of the releases in this list.
+func (releases ReleaseList) Versions() []Version {
+	versions := make([]Version, len(releases))
+	for i, release := range releases {
+		versions[i] = release.Version
+	}
+	return versions
+}
+
+// Returns every release that MakeAnwork can use from the current ReleaseSource (see
+// getReleaseSource), sorted by version. Only release directories and release archives can list
+// their releases.
+func Releases() (ReleaseList, error) {
+	source, err := getReleaseSource()
+	if err != nil {
+		return nil, err
+	}
+
+	switch source := source.(type) {
+	case *DirSource:
+		return source.Releases()
+	case *ArchiveSource:
+		release, err := source.Release()
+		if err != nil {
+			return nil, err
+		}
+		return ReleaseList{release}, nil
+	default:
+		return nil, fmt.Errorf("Cannot list the releases in %s", source.String())
+	}
+}
+
+// Returns every release in this release directory, sorted by version.
+func (source *DirSource) Releases() (ReleaseList, error) {
+	archivePaths, err := filepath.Glob(filepath.Join(source.Path, "v*", "anwork-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	releases := ReleaseList{}
+	for _, archivePath := range archivePaths {
+		version, ok := parseArchiveVersion(archivePath)
+		if !ok || filepath.Base(filepath.Dir(archivePath)) != "v"+version.String() {
+			continue
+		}
+
+		// Only use the archive that MakeAnwork would use for this version.
+		if expected, err := source.ArchivePath(version); err != nil || expected != archivePath {
+			continue
+		}
+
+		release, err := describeRelease(version, archivePath)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Version.Less(releases[j].Version) })
+	return releases, nil
+}
+
+// Returns the release in this release archive. The version comes from the name of the archive.
+func (source *ArchiveSource) Release() (*Release, error) {
+	version, ok := parseArchiveVersion(source.Path)
+	if !ok {
+		return nil, fmt.Errorf("Cannot tell the version of release archive %s", source.Path)
+	}
+	return describeRelease(version, source.Path)
+}
+
+// Returns the version in the provided release archive name (e.g., 3.1 for anwork-3.1.zip).
+func parseArchiveVersion(archivePath string) (Version, bool) {
+	matches := releaseArchiveRegex.FindStringSubmatch(filepath.Base(archivePath))
+	if matches == nil {
+		return Version{}, false
+	}
+	version, err := ParseVersion(matches[1])
+	return version, err == nil
+}
+
+func describeRelease(version Version, archivePath string) (*Release, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &Release{
+		Version:     version,
+		ArchivePath: archivePath,
+		Hash:        hash,
+		Size:        info.Size(),
+		Platforms:   []string{},
+		Docs:        []string{},
+	}
+	root := fmt.Sprintf("anwork-%s/", version)
+	err = walkArchive(archivePath, func(entry *archiveEntry) error {
+		if !entry.Info.Mode().IsRegular() || !strings.HasPrefix(entry.Name, root) {
+			return nil
+		}
+
+		name := strings.TrimPrefix(entry.Name, root)
+		dir, base := path.Split(name)
+		if strings.HasPrefix(dir, "doc/") {
+			release.Docs = append(release.Docs, name)
+		} else if matches := platformBinaryRegex.FindStringSubmatch(base); dir == "bin/" && matches != nil {
+			release.Platforms = append(release.Platforms, matches[1]+"/"+matches[2])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(release.Platforms)
+	sort.Strings(release.Docs)
+	return release, nil
+}
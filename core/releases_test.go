@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReleases(t *testing.T) {
+	t.Parallel()
+
+	releaseDir := mustMakeTmpDir(t, "anwork-releases")
+	defer os.RemoveAll(releaseDir)
+	for _, version := range []string{"3", "1", "10", "3.1", "4.0.0-rc1"} {
+		versionDir := filepath.Join(releaseDir, "v"+version)
+		if err := os.Mkdir(versionDir, os.ModeDir|os.ModePerm); err != nil {
+			t.Fatal("Could not create version directory:", err)
+		}
+		root := fmt.Sprintf("anwork-%s/", version)
+		writeTestArchive(t, filepath.Join(versionDir, fmt.Sprintf("anwork-%s.tar.gz", version)), []testArchiveEntry{
+			{root + "bin/anwork", 0755, "#!/bin/sh\n"},
+			{root + "bin/anwork_linux_amd64", 0755, "linux"},
+			{root + "bin/anwork_darwin_arm64", 0755, "darwin"},
+			{root + "doc/CLI.md", 0644, "# CLI\n"},
+			{root + "lib/anwork.jar", 0644, "jar"},
+		})
+	}
+	// These are not releases.
+	if err := os.Mkdir(filepath.Join(releaseDir, "v2"), os.ModeDir|os.ModePerm); err != nil {
+		t.Fatal("Could not create version directory:", err)
+	}
+	mustCopyFile(t, testZipPath, filepath.Join(releaseDir, "v2", "anwork-2.txt"))
+	mustCopyFile(t, testZipPath, filepath.Join(releaseDir, "v2", "anwork-4.zip"))
+
+	releases, err := (&DirSource{Path: releaseDir}).Releases()
+	if err != nil {
+		t.Fatal("Could not list releases:", err)
+	}
+	expected := []string{"1", "3", "3.1", "4.0.0-rc1", "10"}
+	if versions := versionStrings(releases.Versions()); !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("Expected versions %v, got %v", expected, versions)
+	}
+
+	release := releases.Latest()
+	if release.Version.String() != "10" {
+		t.Errorf("Expected latest version 10, got %s", release.Version)
+	}
+	if !reflect.DeepEqual(release.Platforms, []string{"darwin/arm64", "linux/amd64"}) {
+		t.Errorf("Unexpected platforms: %v", release.Platforms)
+	} else if !release.HasPlatform("linux/amd64") || release.HasPlatform("windows/amd64") {
+		t.Errorf("Unexpected HasPlatform results for %v", release.Platforms)
+	}
+	if !reflect.DeepEqual(release.Docs, []string{"doc/CLI.md"}) {
+		t.Errorf("Unexpected docs: %v", release.Docs)
+	}
+	if hash, err := hashFile(release.ArchivePath); err != nil || hash != release.Hash {
+		t.Errorf("Expected hash %s, got %s (error: %v)", hash, release.Hash, err)
+	}
+
+	inRange := releases.Range(MustParseVersion("3.1"), MustParseVersion("4"))
+	if versions := versionStrings(inRange.Versions()); !reflect.DeepEqual(versions, []string{"3.1", "4.0.0-rc1"}) {
+		t.Errorf("Expected versions [3.1 4.0.0-rc1] in range, got %v", versions)
+	}
+	if releases.Get(MustParseVersion("3.1.0")) == nil || releases.Get(MajorVersion(2)) != nil {
+		t.Error("Unexpected results from Get")
+	}
+	if archivePath, err := (&DirSource{Path: releaseDir}).ArchivePath(MustParseVersion("3.1.0")); err != nil {
+		t.Error("Expected to find release archive for 3.1.0:", err)
+	} else if filepath.Base(archivePath) != "anwork-3.1.tar.gz" {
+		t.Errorf("Expected release archive anwork-3.1.tar.gz for 3.1.0, got %s", archivePath)
+	}
+	if (ReleaseList{}).Latest() != nil {
+		t.Error("Expected no latest release in empty list")
+	}
+}
+
+func TestRepoReleases(t *testing.T) {
+	t.Parallel()
+
+	releases, err := mustGetReleaseDir(t).Releases()
+	if err != nil {
+		t.Fatal("Could not list releases:", err)
+	}
+	for _, release := range releases {
+		t.Logf("Found release %s", release.String())
+	}
+
+	release := releases.Get(defaultVersion)
+	if release == nil {
+		t.Fatalf("Expected release %s in %v", defaultVersion, releases.Versions())
+	} else if len(release.Docs) == 0 {
+		t.Errorf("Expected release %s to have docs", defaultVersion)
+	}
+	if latest := releases.Latest(); !latest.Version.AtLeast(defaultVersion) {
+		t.Errorf("Expected latest release to be at least %s, got %s", defaultVersion, latest.Version)
+	}
+}
+
+func versionStrings(versions []Version) []string {
+	strings := make([]string, len(versions))
+	for i, version := range versions {
+		strings[i] = version.String()
+	}
+	return strings
+}
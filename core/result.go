@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunResult describes a single command that was run on an Anwork instance. See Anwork.Execute.
+type RunResult struct {
+	// This is the full argument vector that was run, starting with the path to the anwork binary.
+	Args []string
+
+	// This is everything that the command printed to stdout.
+	Stdout string
+
+	// This is everything that the command printed to stderr.
+	Stderr string
+
+	// This is the exit status of the command. It is 0 when the command succeeded.
+	ExitCode int
+
+	// This is the wall clock time that it took to run the command.
+	Duration time.Duration
+}
+
+// Returns true iff the command exited with a 0 exit status.
+func (result *RunResult) Success() bool {
+	return result.ExitCode == 0
+}
+
+// Returns nil if the command succeeded, otherwise an error describing the command, its exit status,
+// and what it printed to stderr.
+func (result *RunResult) Err() error {
+	if result.Success() {
+		return nil
+	}
+	return fmt.Errorf("Command '%s' exited with status %d: %s",
+		result.Command(), result.ExitCode, strings.TrimSpace(result.Stderr))
+}
+
+// Returns the command that was run as a single string, without the path to the anwork binary.
+func (result *RunResult) Command() string {
+	if len(result.Args) == 0 {
+		return ""
+	}
+	return strings.Join(result.Args[1:], " ")
+}
+
+func (result *RunResult) String() string {
+	return fmt.Sprintf("'%s' (exit %d, took %s)", result.Command(), result.ExitCode, result.Duration)
+}
+
+// TimeoutError is returned from Anwork.ExecuteContext (and friends) when a command is killed before
+// it completes, either because it ran for longer than the Anwork instance's timeout or because the
+// provided context was canceled.
+type TimeoutError struct {
+	// This is what is known about the command that was killed. The ExitCode field is meaningless,
+	// but the Stdout and Stderr fields hold what the command printed before it was killed.
+	Result *RunResult
+
+	// This is the reason that the command was killed, i.e., context.DeadlineExceeded or
+	// context.Canceled.
+	Err error
+}
+
+func (err *TimeoutError) Error() string {
+	reason := "was canceled"
+	if err.Err == context.DeadlineExceeded {
+		reason = "timed out"
+	}
+	return fmt.Sprintf("Command '%s' %s after %s\nstdout so far:\n%s\nstderr so far:\n%s",
+		err.Result.Command(), reason, err.Result.Duration, err.Result.Stdout, err.Result.Stderr)
+}
+
+func (err *TimeoutError) Unwrap() error {
+	return err.Err
+}
+
+// InvalidContextError is returned from Anwork.Execute (and friends) when a command leaves a context
+// that is invalid behind (see WithValidation).
+type InvalidContextError struct {
+	// This is the command that left the invalid context behind.
+	Result *RunResult
+
+	// This is the path to the invalid context file.
+	Path string
+
+	// This describes what is wrong with the context, e.g., an *anworkcontext.ValidationError.
+	Err error
+}
+
+func (err *InvalidContextError) Error() string {
+	return fmt.Sprintf("Command '%s' left invalid context %s: %s", err.Result.Command(), err.Path, err.Err)
+}
+
+func (err *InvalidContextError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ContextSnapshot is the state of the context directory of an Anwork instance at some point in a
+// test (see Anwork.Snapshot). It can be used to put an Anwork instance back into that state (see
+// Anwork.Restore), or to branch a new Anwork instance off of it (see Anwork.Fork), so that an
+// expensive setup only has to be run once for a number of follow-up scenarios.
+//
+// A ContextSnapshot is immutable, so it is safe to use it from more than one goroutine.
+type ContextSnapshot struct {
+	// This maps the name of every context file in the context directory to its contents.
+	files map[string][]byte
+}
+
+// Take a snapshot of the context directory of this Anwork instance. A snapshot of an Anwork instance
+// that has not run any commands yet is a snapshot of the empty state.
+func (anwork *Anwork) Snapshot() (*ContextSnapshot, error) {
+	infos, err := ioutil.ReadDir(anwork.contextPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("Cannot read context directory: " + err.Error())
+	}
+
+	snapshot := &ContextSnapshot{files: map[string][]byte{}}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(anwork.contextPath, info.Name()))
+		if err != nil {
+			return nil, errors.New("Cannot read context: " + err.Error())
+		}
+		snapshot.files[info.Name()] = contents
+	}
+	return snapshot, nil
+}
+
+// Put the context directory of this Anwork instance back into the state in the provided snapshot.
+// Any context file that is not in the snapshot is deleted.
+func (anwork *Anwork) Restore(snapshot *ContextSnapshot) error {
+	infos, err := ioutil.ReadDir(anwork.contextPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("Cannot read context directory: " + err.Error())
+	}
+	for _, info := range infos {
+		if _, ok := snapshot.files[info.Name()]; !ok && info.Mode().IsRegular() {
+			if err := os.Remove(filepath.Join(anwork.contextPath, info.Name())); err != nil {
+				return errors.New("Cannot delete context: " + err.Error())
+			}
+		}
+	}
+
+	return snapshot.writeTo(anwork.contextPath)
+}
+
+// Make a new Anwork instance that runs the same anwork binary with the same configuration as this
+// one, but in its own context directory that starts out in the state in the provided snapshot. The
+// new Anwork instance is cleaned up with the same test as this one (see WithCleanup); otherwise, it
+// should be closed when it is no longer needed.
+func (anwork *Anwork) Fork(snapshot *ContextSnapshot) (*Anwork, error) {
+	if anwork.binaryPath == "" {
+		return nil, errors.New("Anwork instance has no binary (has it been closed?)")
+	}
+
+	contextPath, err := makeContextDir(anwork.contextRoot, anwork.tb)
+	if err != nil {
+		return nil, err
+	}
+	if contextPath, err = filepath.Abs(contextPath); err != nil {
+		os.RemoveAll(contextPath)
+		return nil, err
+	}
+	if err := snapshot.writeTo(contextPath); err != nil {
+		os.RemoveAll(contextPath)
+		return nil, err
+	}
+
+	fork := new(Anwork)
+	*fork = *anwork
+	fork.contextPath = contextPath
+	fork.ownsContext = true
+	fork.env = append([]string{}, anwork.env...)
+	if fork.tb != nil {
+		fork.tb.Cleanup(fork.cleanup)
+	}
+	return fork, nil
+}
+
+// Write the context files in this snapshot into the provided context directory.
+func (snapshot *ContextSnapshot) writeTo(contextPath string) error {
+	if err := os.MkdirAll(contextPath, os.ModeDir|os.ModePerm); err != nil {
+		return errors.New("Cannot create context directory: " + err.Error())
+	}
+	for name, contents := range snapshot.files {
+		if err := ioutil.WriteFile(filepath.Join(contextPath, name), contents, 0644); err != nil {
+			return errors.New("Cannot write context: " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	root := mustMakeTmpDir(t, "anwork-snapshot")
+	defer os.RemoveAll(root)
+
+	anwork := MustMakeAnwork(t, defaultVersion, WithContextRoot(root))
+	empty, err := anwork.Snapshot()
+	if err != nil {
+		t.Fatal("Failed to snapshot empty context:", err)
+	}
+
+	mustRun(t, anwork, "create", "task-a")
+	snapshot, err := anwork.Snapshot()
+	if err != nil {
+		t.Fatal("Failed to snapshot context:", err)
+	}
+
+	// Diverge from the snapshot in a couple of forks. They should not see each other's changes.
+	forkA, err := anwork.Fork(snapshot)
+	if err != nil {
+		t.Fatal("Failed to fork:", err)
+	}
+	forkB, err := anwork.Fork(snapshot)
+	if err != nil {
+		t.Fatal("Failed to fork:", err)
+	}
+	if forkA.contextPath == forkB.contextPath || forkA.contextPath == anwork.contextPath {
+		t.Fatalf("Expected forks to have their own context directories, got %s and %s",
+			forkA.contextPath, forkB.contextPath)
+	} else if filepath.Dir(forkA.contextPath) != root {
+		t.Errorf("Expected fork context directory %s to be in %s", forkA.contextPath, root)
+	}
+	mustRun(t, forkA, "create", "task-b")
+	mustRun(t, forkB, "delete", "task-a")
+	expectTasks(t, forkA, "task-a", "task-b")
+	expectTasks(t, forkB)
+	expectTasks(t, anwork, "task-a")
+
+	// Restore the original instance back to the snapshot, and then back to the beginning.
+	mustRun(t, anwork, "create", "task-c")
+	if err := anwork.Restore(snapshot); err != nil {
+		t.Fatal("Failed to restore:", err)
+	}
+	expectTasks(t, anwork, "task-a")
+	if err := anwork.Restore(empty); err != nil {
+		t.Fatal("Failed to restore:", err)
+	}
+	expectTasks(t, anwork)
+
+	forkPath := forkA.contextPath
+	if err := forkA.Close(); err != nil {
+		t.Error("Failed to close fork:", err)
+	} else if fileExists(forkPath) {
+		t.Errorf("Expected fork context directory %s to be deleted", forkPath)
+	}
+	if _, err := forkA.Fork(snapshot); err == nil {
+		t.Error("Expected an error forking a closed Anwork instance")
+	}
+}
+
+func mustRun(t *testing.T, anwork *Anwork, command ...string) {
+	t.Helper()
+	if _, err := anwork.Run(command...); err != nil {
+		t.Fatalf("Failed to run '%s': %s", strings.Join(command, " "), err)
+	}
+}
+
+// Check that the provided Anwork instance has exactly the provided tasks.
+func expectTasks(t *testing.T, anwork *Anwork, names ...string) {
+	t.Helper()
+	output, err := anwork.Run("show")
+	if err != nil {
+		t.Fatal("Failed to show tasks:", err)
+	}
+	count := 0
+	for _, line := range makeOutputLines(output) {
+		if strings.HasPrefix(line, "  ") {
+			count++
+		}
+	}
+	if count != len(names) {
+		t.Errorf("Expected tasks %v, got:\n%s", names, output)
+	}
+	for _, name := range names {
+		if !strings.Contains(output, name) {
+			t.Errorf("Expected task %s, got:\n%s", name, output)
+		}
+	}
+}
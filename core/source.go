@@ -0,0 +1,301 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// This environment variable can hold the path to the ReleaseSource that MakeAnwork should use. See
+// MakeReleaseSource for the kinds of paths that are accepted.
+const ReleaseEnv = "ANWORK_RELEASE"
+
+// If this environment variable is set (to anything), then release archives are used without being
+// verified against their manifest (see Manifest). See DirSource.SkipVerification.
+const SkipVerificationEnv = "ANWORK_SKIP_VERIFICATION"
+
+// ReleaseSource is somewhere that anwork releases come from, e.g., the release directory in this
+// repo. MakeAnwork uses a ReleaseSource to find the anwork binary for a version.
+type ReleaseSource interface {
+	// Returns the path to the anwork binary for the provided version. The release is unpacked first
+	// if it needs to be. An error is returned if this source does not have the version.
+	Binary(version Version) (string, error)
+
+	String() string
+}
+
+// DirSource is a release directory that is laid out like the release directory in this repo, i.e.,
+// the release for version X lives at vX/anwork-X.zip (or vX/anwork-X.tar.gz). See release/README.
+type DirSource struct {
+	// This is the path to the release directory.
+	Path string
+
+	// Every release archive in a release directory must have a matching entry in the MANIFEST file
+	// next to it, and it is verified against that entry before it is used. If this is true, then
+	// release archives are used without any verification (e.g., while putting a release together by
+	// hand).
+	SkipVerification bool
+}
+
+// Returns the path to the release archive for the provided version. The version does not need to be
+// written the same way as the release directory (e.g., version 3.1.0 is found in v3.1).
+func (source *DirSource) ArchivePath(version Version) (string, error) {
+	if versionDir, dirVersion, ok := findVersionDir(source.Path, "v", version); ok {
+		for _, extension := range archiveExtensions {
+			archivePath := filepath.Join(versionDir, fmt.Sprintf("anwork-%s%s", dirVersion, extension))
+			if _, err := os.Stat(archivePath); err == nil {
+				return archivePath, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Cannot find release archive for version %s in %s", version, source.Path)
+}
+
+func (source *DirSource) Binary(version Version) (string, error) {
+	archivePath, err := source.ArchivePath(version)
+	if err != nil {
+		return "", err
+	}
+
+	archive := &ArchiveSource{
+		Path:             archivePath,
+		RequireManifest:  !source.SkipVerification,
+		SkipVerification: source.SkipVerification,
+	}
+	return archive.Binary(version)
+}
+
+func (source *DirSource) String() string {
+	return fmt.Sprintf("release directory %s", source.Path)
+}
+
+// ArchiveSource is a single release archive, i.e., a zip or tar.gz file whose contents are laid out
+// as described in release/README.
+type ArchiveSource struct {
+	// This is the path to the release archive.
+	Path string
+
+	// This is the cache directory that the release archive will be unpacked into. If it is empty,
+	// then the shared cache directory is used (see CacheEnv).
+	CacheDir string
+
+	// If this is true, then it is an error for the release archive to not have a manifest next to it.
+	// DirSource sets this, since every release archive in a release directory should have one.
+	RequireManifest bool
+
+	// If this is true, then the release archive is not verified against its manifest, even if it has
+	// one.
+	SkipVerification bool
+}
+
+// Returns the path to the anwork binary in this release archive. If there is a manifest next to the
+// release archive (see Manifest), then the archive and its unpacked files are verified against it
+// first, unless SkipVerification is set. A cache entry that no longer matches the manifest is
+// unpacked again.
+func (source *ArchiveSource) Binary(version Version) (string, error) {
+	cacheDir := source.CacheDir
+	if cacheDir == "" {
+		var err error
+		if cacheDir, err = CacheDir(); err != nil {
+			return "", err
+		}
+	}
+
+	var manifest *Manifest
+	var err error
+	if !source.SkipVerification {
+		manifest, err = findManifest(source.Path, source.RequireManifest)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Parallel tests share the hash of the release archive, so that it is only read once. Other test
+	// processes share it too, via the cache directory, but only if the archive does not need to be
+	// verified: the hash that is checked against the manifest has to come from the bytes that are in
+	// the archive now.
+	var hash string
+	if manifest != nil {
+		hash, err = hashFile(source.Path)
+	} else {
+		hash, err = hashFileCached(source.Path, cacheDir)
+	}
+	if err != nil {
+		return "", err
+	}
+	if manifest != nil {
+		if err := manifest.verifyArchiveHash(source.Path, hash); err != nil {
+			return "", err
+		}
+	}
+
+	unpackPath, err := unpackIntoCache(cacheDir, source.Path, hash)
+	if err != nil {
+		return "", err
+	}
+
+	if manifest != nil {
+		if err := manifest.VerifyTree(unpackPath); err != nil {
+			// The archive is fine, so the cache entry must have been changed after it was unpacked.
+			// Unpack it again (once) rather than failing the same way forever.
+			if err := removeCacheEntry(CacheEntry{Path: unpackPath}); err != nil {
+				return "", err
+			}
+			if unpackPath, err = unpackIntoCache(cacheDir, source.Path, hash); err != nil {
+				return "", err
+			}
+			if err := manifest.VerifyTree(unpackPath); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// The release archive keeps the mode bits of the binary, so there is no need to chmod it here.
+	return (&TreeSource{Path: unpackPath}).Binary(version)
+}
+
+func (source *ArchiveSource) String() string {
+	return fmt.Sprintf("release archive %s", source.Path)
+}
+
+// TreeSource is a release that has already been unpacked. The Path can either be the directory
+// that holds the anwork-X directory, or the anwork-X directory itself.
+type TreeSource struct {
+	// This is the path to the unpacked release.
+	Path string
+}
+
+func (source *TreeSource) Binary(version Version) (string, error) {
+	root, _, ok := findVersionDir(source.Path, "anwork-", version)
+	if !ok {
+		if _, err := os.Stat(filepath.Join(source.Path, "bin")); err != nil {
+			return "", fmt.Errorf("Cannot find release for version %s in %s", version, source.Path)
+		}
+		root = source.Path
+	}
+
+	binary, exists := findBinary(root)
+	if !exists {
+		return "", errors.New("Cannot find anwork binary at destinationPath: " + binary)
+	}
+
+	return binary, nil
+}
+
+func (source *TreeSource) String() string {
+	return fmt.Sprintf("release tree %s", source.Path)
+}
+
+// Returns the directory in the provided parent directory whose name is the provided prefix followed
+// by the provided version (e.g., v3.1 or anwork-3.1), along with the version as the directory writes
+// it. The version is looked up exactly as written first, and then by comparing versions.
+func findVersionDir(parent, prefix string, version Version) (string, Version, bool) {
+	dir := filepath.Join(parent, prefix+version.String())
+	if _, err := os.Stat(dir); err == nil {
+		return dir, version, true
+	}
+
+	dirs, _ := filepath.Glob(filepath.Join(parent, prefix+"*"))
+	for _, dir := range dirs {
+		dirVersion, err := ParseVersion(strings.TrimPrefix(filepath.Base(dir), prefix))
+		if err == nil && dirVersion.Equal(version) {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return dir, dirVersion, true
+			}
+		}
+	}
+	return "", Version{}, false
+}
+
+// Make a ReleaseSource for the provided path. If the path is an archive, then an ArchiveSource is
+// returned. If the path is a directory that looks like the release directory in this repo (i.e., it
+// has vX/anwork-X.* files in it), then a DirSource is returned. Otherwise, a TreeSource is returned.
+// Release archives are not verified if the SkipVerificationEnv environment variable is set.
+func MakeReleaseSource(path string) (ReleaseSource, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if !isArchive(path) {
+			return nil, fmt.Errorf("Release source %s is not a directory or a known archive format", path)
+		}
+		return &ArchiveSource{Path: path, SkipVerification: skipVerification()}, nil
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(path, "v*", "anwork-*")); len(matches) > 0 {
+		return &DirSource{Path: path, SkipVerification: skipVerification()}, nil
+	}
+
+	return &TreeSource{Path: path}, nil
+}
+
+// Returns the release directory in this repo by walking up from the current working directory until
+// a release directory with a README in it is found. This means that the framework can be run from
+// anywhere inside of this repo.
+func findReleaseDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		releaseDir := filepath.Join(dir, "release")
+		if _, err := os.Stat(filepath.Join(releaseDir, "README")); err == nil {
+			return releaseDir, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("Cannot find release directory; set %s or pass -release", ReleaseEnv)
+		}
+		dir = parent
+	}
+}
+
+// This is the ReleaseSource that MakeAnwork uses. It is nil until it is first needed, or until it
+// is set by RunTests.
+var releaseSource ReleaseSource
+
+// This is the lock that guards the releaseSource variable.
+var releaseSourceMutex sync.Mutex
+
+// Returns the ReleaseSource that MakeAnwork should use. If RunTests did not set one up, then the
+// ReleaseEnv environment variable is consulted. If that is not set either, then the release
+// directory in this repo is used (see findReleaseDir).
+func getReleaseSource() (ReleaseSource, error) {
+	releaseSourceMutex.Lock()
+	defer releaseSourceMutex.Unlock()
+
+	if releaseSource != nil {
+		return releaseSource, nil
+	}
+
+	var err error
+	if path := os.Getenv(ReleaseEnv); path != "" {
+		releaseSource, err = MakeReleaseSource(path)
+	} else if path, err = findReleaseDir(); err == nil {
+		releaseSource = &DirSource{Path: path, SkipVerification: skipVerification()}
+	}
+	return releaseSource, err
+}
+
+// Returns true iff the SkipVerificationEnv environment variable is set.
+func skipVerification() bool {
+	return os.Getenv(SkipVerificationEnv) != ""
+}
+
+func setReleaseSource(source ReleaseSource) {
+	releaseSourceMutex.Lock()
+	defer releaseSourceMutex.Unlock()
+	releaseSource = source
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMakeReleaseSource(t *testing.T) {
+	t.Parallel()
+
+	releaseDir := mustGetReleaseDir(t).Path
+	archivePath, err := mustGetReleaseDir(t).ArchivePath(defaultVersion)
+	if err != nil {
+		t.Fatal("Cannot find release archive:", err)
+	}
+	treePath, err := ioutil.TempDir("", "anwork-tree")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(treePath)
+
+	data := []struct {
+		path   string
+		source ReleaseSource
+	}{
+		{releaseDir, &DirSource{}},
+		{archivePath, &ArchiveSource{}},
+		{treePath, &TreeSource{}},
+	}
+	for _, datum := range data {
+		source, err := MakeReleaseSource(datum.path)
+		if err != nil {
+			t.Errorf("Could not make release source for %s: %s", datum.path, err)
+		} else if fmt.Sprintf("%T", source) != fmt.Sprintf("%T", datum.source) {
+			t.Errorf("Expected %T for %s, got %s", datum.source, datum.path, source)
+		} else {
+			t.Logf("Made %s", source)
+		}
+	}
+
+	bads := []string{"this/path/does/not/exist", "../README.md"}
+	for _, bad := range bads {
+		if source, err := MakeReleaseSource(bad); err == nil {
+			t.Errorf("Expected error from making release source for %s, got %s", bad, source)
+		}
+	}
+}
+
+func TestArchiveAndTreeSources(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping TestArchiveAndTreeSources on windows because it uses a shell script")
+	}
+
+	tmpDirPath, err := ioutil.TempDir("", "anwork-sources")
+	if err != nil {
+		t.Fatal("Could not create tmp directory:", err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	archivePath := filepath.Join(tmpDirPath, "anwork-7.tar.gz")
+	writeFakeTarball(t, archivePath, 7)
+	archive := &ArchiveSource{Path: archivePath, CacheDir: tmpDirPath}
+
+	binary, err := archive.Binary(MajorVersion(7))
+	if err != nil {
+		t.Fatalf("Could not get binary from %s: %s", archive, err)
+	}
+	checkFakeBinary(t, binary, "ANWORK Version = 7\n")
+	if _, err := archive.Binary(MajorVersion(8)); err == nil {
+		t.Errorf("Expected error from getting the wrong version from %s", archive)
+	}
+
+	// The archive has now been unpacked, so it can be used as a tree.
+	treePath := filepath.Dir(filepath.Dir(filepath.Dir(binary)))
+	for _, path := range []string{treePath, filepath.Join(treePath, "anwork-7")} {
+		tree := &TreeSource{Path: path}
+		if treeBinary, err := tree.Binary(MajorVersion(7)); err != nil {
+			t.Errorf("Could not get binary from %s: %s", tree, err)
+		} else {
+			checkFakeBinary(t, treeBinary, "ANWORK Version = 7\n")
+		}
+	}
+	if _, err := (&TreeSource{Path: tmpDirPath}).Binary(MajorVersion(7)); err == nil {
+		t.Error("Expected error from getting binary from a tree with no release in it")
+	}
+}
+
+// Write a tar.gz release for the provided version whose anwork binary only knows how to print its
+// version.
+func writeFakeTarball(t *testing.T, archivePath string, version int) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal("Could not create archive:", err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	script := []byte(fmt.Sprintf("#!/bin/sh\necho ANWORK Version = %d\n", version))
+	header := &tar.Header{
+		Name:     fmt.Sprintf("anwork-%d/bin/anwork", version),
+		Mode:     0755,
+		Size:     int64(len(script)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		t.Fatal("Could not write tar header:", err)
+	}
+	if _, err := tarWriter.Write(script); err != nil {
+		t.Fatal("Could not write tar file:", err)
+	}
+}
+
+func checkFakeBinary(t *testing.T, binary, expected string) {
+	output, err := exec.Command(binary, "version").Output()
+	if err != nil {
+		t.Errorf("Could not run binary %s: %s", binary, err)
+	} else if string(output) != expected {
+		t.Errorf("Expected '%s' from binary %s, got '%s'", expected, binary, output)
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TranscriptStep is a command in a transcript, along with the output that it is expected to print.
+// See ReadTranscript.
+type TranscriptStep struct {
+	// This is the command, without the anwork binary, e.g., []string{"show", "task-a"}.
+	Command []string
+
+	// These are the lines that the command is expected to print to stdout.
+	Output []string
+}
+
+// Read the transcript in the provided file, e.g., the README next to a fixture (see WithFixture). A
+// transcript is a text file with commands in it that look like "$ anwork show task-a", each of
+// which is followed by the lines that the command prints, up until the next blank line. The
+// indentation of the command line is stripped from its output lines. Every other line in the file is
+// ignored.
+func ReadTranscript(path string) ([]TranscriptStep, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	steps := []TranscriptStep{}
+	var step *TranscriptStep
+	var indent string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "$ anwork") {
+			steps = append(steps, TranscriptStep{Command: strings.Fields(trimmed)[2:], Output: []string{}})
+			step = &steps[len(steps)-1]
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		} else if trimmed == "" {
+			step = nil
+		} else if step != nil {
+			step.Output = append(step.Output, strings.TrimPrefix(line, indent))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("Transcript %s does not have any anwork commands in it", path)
+	}
+	return steps, nil
+}
+
+// Run every step in the provided transcript on this Anwork instance, in order. Returns an error
+// describing every step that failed or printed something other than what the transcript says.
+func (anwork *Anwork) CheckTranscript(steps []TranscriptStep) error {
+	problems := []string{}
+	for _, step := range steps {
+		output, err := anwork.Run(step.Command...)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		actual, expected := makeOutputLines(output), step.Output
+		if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+			problems = append(problems, fmt.Sprintf("'anwork %s' printed:\n    %s\n  expected:\n    %s",
+				strings.Join(step.Command, " "), strings.Join(actual, "\n    "),
+				strings.Join(expected, "\n    ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Transcript did not match:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
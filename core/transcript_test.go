@@ -0,0 +1,104 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testTranscript = `This is the fixture for the tests.
+
+  $ anwork show
+  RUNNING tasks:
+    task-a (1)
+  FINISHED tasks:
+
+And this is what is in its journal.
+
+  $ anwork journal
+  [Fri Jan  1 00:00:00 EST 2021]: Created task task-a
+`
+
+func TestReadTranscript(t *testing.T) {
+	t.Parallel()
+
+	dir := mustMakeTmpDir(t, "anwork-transcript")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "README")
+	if err := ioutil.WriteFile(path, []byte(testTranscript), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := ReadTranscript(path)
+	if err != nil {
+		t.Fatal("Failed to read transcript:", err)
+	}
+
+	expected := []TranscriptStep{
+		{Command: []string{"show"}, Output: []string{"RUNNING tasks:", "  task-a (1)", "FINISHED tasks:"}},
+		{Command: []string{"journal"}, Output: []string{"[Fri Jan  1 00:00:00 EST 2021]: Created task task-a"}},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expected transcript %v, got %v", expected, steps)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("There are no commands here.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTranscript(path); err == nil {
+		t.Error("Expected an error reading a transcript without any commands")
+	}
+}
+
+func TestFixture(t *testing.T) {
+	t.Parallel()
+
+	dir := mustMakeTmpDir(t, "anwork-fixture")
+	defer os.RemoveAll(dir)
+
+	// Make a context with a task in it, and then use it as a fixture.
+	fixture := filepath.Join(dir, "fixture")
+	anwork := MustMakeAnwork(t, defaultVersion, WithContextDir(dir))
+	if _, err := anwork.Run("create", "task-a"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := anwork.Run("show", "task-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, defaultContextName), fixture); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []TranscriptStep{{Command: []string{"show", "task-a"}, Output: makeOutputLines(output)}}
+	for i := 0; i < 2; i++ {
+		anwork := MustMakeAnwork(t, defaultVersion, WithFixture(fixture))
+		if err := anwork.CheckTranscript(steps); err != nil {
+			t.Error("Expected fixture to have task-a:", err)
+		}
+		if _, err := anwork.Run("delete", "task-a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := anwork.CheckTranscript(steps); err == nil {
+			t.Error("Expected transcript to fail after the task was deleted")
+		}
+	}
+
+	// The fixture is copied, so the deletes above should not have changed it.
+	if actual, err := ioutil.ReadFile(fixture); err != nil {
+		t.Fatal(err)
+	} else if string(actual) != string(contents) {
+		t.Error("Expected fixture to be unchanged")
+	}
+
+	if _, err := MakeAnwork(defaultVersion, WithFixture(filepath.Join(dir, "missing"))); err == nil {
+		t.Error("Expected an error for a missing fixture")
+	}
+}
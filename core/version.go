@@ -0,0 +1,163 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This is the regular expression that matches a version string, e.g., "3", "3.1", or "4.0.0-rc1".
+var versionStringRegex = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+// Version is an anwork version. Versions look like "3", "3.1", or "4.0.0-rc1", and they are ordered
+// like semantic versions: missing minor and patch numbers are 0, and a prerelease (e.g., "rc1")
+// comes before the release itself. The zero Version is not a legitimate anwork version.
+//
+// A *Version can be used as a flag.Value.
+type Version struct {
+	Major, Minor, Patch int
+
+	// This is the prerelease part of the version, e.g., "rc1" for "4.0.0-rc1".
+	Prerelease string
+
+	// This is the number of numeric parts that the version was written with (e.g., 2 for "3.1"), so
+	// that String returns the version as it was written (and as its release directory is named).
+	parts int
+}
+
+// Returns the Version for the provided major version number, e.g., 2 for anwork version 2.
+func MajorVersion(major int) Version {
+	return Version{Major: major, parts: 1}
+}
+
+// Parse the provided version string, e.g., "3", "3.1", or "4.0.0-rc1".
+func ParseVersion(s string) (Version, error) {
+	matches := versionStringRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return Version{}, fmt.Errorf("Invalid anwork version '%s'", s)
+	}
+
+	version := Version{Prerelease: matches[4]}
+	numbers := []*int{&version.Major, &version.Minor, &version.Patch}
+	for i, number := range numbers {
+		if matches[i+1] == "" {
+			break
+		}
+		var err error
+		if *number, err = strconv.Atoi(matches[i+1]); err != nil {
+			return Version{}, fmt.Errorf("Invalid anwork version '%s': %s", s, err)
+		}
+		version.parts = i + 1
+	}
+	return version, nil
+}
+
+// This is the same as ParseVersion, except that it panics if the version cannot be parsed.
+func MustParseVersion(s string) Version {
+	version, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+// Returns the version as it was written, e.g., "3.1".
+func (version Version) String() string {
+	if version.IsZero() {
+		return "0"
+	}
+
+	parts := []string{strconv.Itoa(version.Major), strconv.Itoa(version.Minor), strconv.Itoa(version.Patch)}
+	count := version.parts
+	if count == 0 {
+		count = 3
+	}
+	s := strings.Join(parts[:count], ".")
+	if version.Prerelease != "" {
+		s += "-" + version.Prerelease
+	}
+	return s
+}
+
+// This is part of the flag.Value interface.
+func (version *Version) Set(s string) error {
+	parsed, err := ParseVersion(s)
+	if err != nil {
+		return err
+	}
+	*version = parsed
+	return nil
+}
+
+// Returns true iff this is the zero Version, i.e., no version.
+func (version Version) IsZero() bool {
+	return version.Major == 0 && version.Minor == 0 && version.Patch == 0 && version.Prerelease == ""
+}
+
+// Returns a negative number if this version comes before the provided version, 0 if they are the
+// same version (e.g., "3.1" and "3.1.0"), and a positive number if this version comes after the
+// provided version.
+func (version Version) Compare(other Version) int {
+	numbers := [][2]int{
+		{version.Major, other.Major},
+		{version.Minor, other.Minor},
+		{version.Patch, other.Patch},
+	}
+	for _, pair := range numbers {
+		if pair[0] != pair[1] {
+			return pair[0] - pair[1]
+		}
+	}
+	return comparePrereleases(version.Prerelease, other.Prerelease)
+}
+
+// Returns true iff this version and the provided version are the same version.
+func (version Version) Equal(other Version) bool {
+	return version.Compare(other) == 0
+}
+
+// Returns true iff this version comes before the provided version.
+func (version Version) Less(other Version) bool {
+	return version.Compare(other) < 0
+}
+
+// Returns true iff this version is the provided version or comes after it.
+func (version Version) AtLeast(other Version) bool {
+	return version.Compare(other) >= 0
+}
+
+// Compare two prerelease strings like semantic versions do: no prerelease comes after every
+// prerelease, and dot separated identifiers are compared numerically if they are numbers and
+// lexically otherwise.
+func comparePrereleases(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return 1
+	} else if b == "" {
+		return -1
+	}
+
+	aIdentifiers, bIdentifiers := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIdentifiers) && i < len(bIdentifiers); i++ {
+		aIdentifier, bIdentifier := aIdentifiers[i], bIdentifiers[i]
+		aNumber, aErr := strconv.Atoi(aIdentifier)
+		bNumber, bErr := strconv.Atoi(bIdentifier)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNumber != bNumber {
+				return aNumber - bNumber
+			}
+		case aErr == nil:
+			return -1 // numbers come before other identifiers
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIdentifier, bIdentifier); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(aIdentifiers) - len(bIdentifiers)
+}
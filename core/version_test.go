@@ -0,0 +1,81 @@
+package core
+
+import (
+	"flag"
+	"sort"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	t.Parallel()
+
+	data := []struct {
+		s       string
+		version Version
+	}{
+		{"3", Version{Major: 3, parts: 1}},
+		{"3.1", Version{Major: 3, Minor: 1, parts: 2}},
+		{"3.1.4", Version{Major: 3, Minor: 1, Patch: 4, parts: 3}},
+		{"4.0.0-rc1", Version{Major: 4, Prerelease: "rc1", parts: 3}},
+		{"4-rc.2", Version{Major: 4, Prerelease: "rc.2", parts: 1}},
+	}
+	for _, d := range data {
+		version, err := ParseVersion(d.s)
+		if err != nil {
+			t.Errorf("Could not parse version %s: %s", d.s, err)
+		} else if version != d.version {
+			t.Errorf("Expected %s to parse to %#v, got %#v", d.s, d.version, version)
+		} else if version.String() != d.s {
+			t.Errorf("Expected %s to print as itself, got %s", d.s, version)
+		}
+	}
+
+	for _, s := range []string{"", "v3", "3.", "3.1.4.1", "3-", "three", "-1"} {
+		if _, err := ParseVersion(s); err == nil {
+			t.Errorf("Expected error from parsing version '%s'", s)
+		}
+	}
+}
+
+func TestVersionOrder(t *testing.T) {
+	t.Parallel()
+
+	expected := []string{"1", "2", "3.0.1", "3.1", "4.0.0-alpha", "4.0.0-rc.1", "4.0.0-rc.2", "4.0.0-rc.10", "4.0.0-rc1", "4", "10"}
+	versions := make([]Version, len(expected))
+	for i := range expected {
+		versions[i] = MustParseVersion(expected[len(expected)-1-i])
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Less(versions[j]) })
+	for i, version := range versions {
+		if version.String() != expected[i] {
+			t.Errorf("Expected %s at index %d, got %s", expected[i], i, version)
+		}
+	}
+
+	if !MustParseVersion("3.1").Equal(MustParseVersion("3.1.0")) || !MajorVersion(3).Equal(MustParseVersion("3.0")) {
+		t.Error("Expected versions with missing minor and patch numbers to be equal to ones with zeros")
+	}
+	if MustParseVersion("4.0.0-rc1").AtLeast(MajorVersion(4)) || !MajorVersion(4).AtLeast(MajorVersion(4)) {
+		t.Error("Unexpected results from AtLeast")
+	}
+}
+
+func TestVersionFlag(t *testing.T) {
+	t.Parallel()
+
+	var version Version
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&version, "v", "version")
+	if err := flags.Parse([]string{"-v", "4.0.0-rc1"}); err != nil {
+		t.Fatal("Could not parse version flag:", err)
+	} else if version.String() != "4.0.0-rc1" {
+		t.Errorf("Expected version 4.0.0-rc1, got %s", version)
+	}
+
+	if !(Version{}).IsZero() || version.IsZero() {
+		t.Error("Unexpected results from IsZero")
+	}
+	if err := flags.Parse([]string{"-v", "nope"}); err == nil {
+		t.Error("Expected error from parsing a bad version flag")
+	}
+}
@@ -38,6 +38,20 @@ if [ ! -d "$dir" ]; then
 fi
 mv submodules/anwork/anwork-$version.zip "$dir"
 
+note "writing manifest"
+go run ./cmd/anworkmanifest "$dir/anwork-$version.zip"
+if [ "$?" -ne 0 ]; then
+    error "failed to write manifest"
+fi
+git add "$dir"
+
+note "adding compatibility corpus"
+(cd compat && go run generate.go -o data -v "$version")
+if [ "$?" -ne 0 ]; then
+    error "failed to add compatibility corpus"
+fi
+git add compat/data
+
 note "commiting"
 hash="$(git -C submodules/anwork log -1 --oneline | awk '{print $1}')"
 git commit -a -m "Rollup anwork to $hash (version $version)."
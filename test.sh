@@ -14,6 +14,7 @@ usage() {
     echo
     echo "Example: $ME -v 15      # Run all tests with version 15"
     echo "Example: $ME -v 15 -t 1 # Run tests in v1 package with version 15"
+    echo "Example: $ME -v 16.1-rc1 # Run all tests with version 16.1-rc1"
 }
 
 note() {
@@ -58,8 +59,23 @@ if [ -z "$version" ]; then
     error "version not specified via -v flag; must specify version"
 fi
 
-if [ ! -z "$version" ] && [ ! -d "release/v$version" ]; then
-    error "unknown version: $version"
+# The tests are run from their package directories, so make any local build or release paths
+# absolute.
+if [ ! -z "$ANWORK_BINARY" ]; then
+    export ANWORK_BINARY="$(cd "$(dirname "$ANWORK_BINARY")" && pwd)/$(basename "$ANWORK_BINARY")"
+fi
+if [ ! -z "$ANWORK_SOURCE" ]; then
+    export ANWORK_SOURCE="$(cd "$ANWORK_SOURCE" && pwd)"
+fi
+if [ -d "$ANWORK_RELEASE" ]; then
+    export ANWORK_RELEASE="$(cd "$ANWORK_RELEASE" && pwd)"
+elif [ ! -z "$ANWORK_RELEASE" ]; then
+    export ANWORK_RELEASE="$(cd "$(dirname "$ANWORK_RELEASE")" && pwd)/$(basename "$ANWORK_RELEASE")"
+fi
+
+# A local build or another release source may have a version that is not in release/
+if [ ! -z "$version" ] && [ -z "$ANWORK_BINARY$ANWORK_SOURCE$ANWORK_RELEASE" ]; then
+    go run ./cmd/anworkreleases -has "$version" || error "unknown version: $version"
 fi
 
 if [ ! -z "$tehst" ] && [ ! -d "v$tehst" ]; then
@@ -67,9 +83,11 @@ if [ ! -z "$tehst" ] && [ ! -d "v$tehst" ]; then
 fi
 
 if [ -z "$tehst" ]; then
+    # The test packages are named after major versions, e.g., v2 tests apply to 2, 2.1, and 3.0.0-rc1.
+    major="$(echo $version | sed -e 's/[.-].*//')"
     for dir in ./v*; do
         testversion="$(echo $(basename $dir) | sed -e 's/v//')"
-        if [ "$version" -ge "$testversion" ]; then
+        if [ "$major" -ge "$testversion" ]; then
             runtest "v$testversion" "$version"
         fi
     done
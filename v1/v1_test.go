@@ -26,23 +26,19 @@ const (
 	taskCPriority    = "20"
 )
 
-var version int
+var version core.Version
 
 func TestMain(m *testing.M) {
 	core.RunTests(m, &version)
 }
 
 func getAnwork(t *testing.T) *core.Anwork {
-	anwork, err := core.MakeAnwork(version)
-	if err != nil {
-		t.Fatal("Cannot get anwork:", err)
-	}
-	return anwork
+	return core.MustMakeAnwork(t, version)
 }
 
 func TestCreate(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of updated 'create' command flags")
 	}
 
@@ -75,7 +71,7 @@ func TestCreate(t *testing.T) {
 
 func TestSetState(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of updated command names")
 	}
 
@@ -119,7 +115,7 @@ func TestSetState(t *testing.T) {
 
 func TestChangePriority(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of simplified printing format")
 	}
 
@@ -148,7 +144,7 @@ func TestChangePriority(t *testing.T) {
 
 func TestNote(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of simplified printing format")
 	}
 
@@ -191,7 +187,7 @@ func TestNote(t *testing.T) {
 
 func TestJournal(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of updated command names")
 	}
 
@@ -222,7 +218,7 @@ func TestJournal(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of updated command names")
 	}
 
@@ -252,7 +248,7 @@ func TestDelete(t *testing.T) {
 
 func TestDeleteAll(t *testing.T) {
 	t.Parallel()
-	if version != 1 {
+	if version.Major != 1 {
 		t.Skipf("Skipping TestNote for non version 1 packages because of updated command names")
 	}
 
@@ -280,7 +276,7 @@ func expectDoesNotContain(t *testing.T, anwork *core.Anwork, taskName string) {
 }
 
 func BenchmarkCreate(b *testing.B) {
-	if version != 1 {
+	if version.Major != 1 {
 		b.Skipf("Skipping BenchmarkCreate for non version 1 packages because of updated command names")
 	}
 
@@ -292,7 +288,7 @@ func BenchmarkCreate(b *testing.B) {
 }
 
 func BenchmarkCrud(b *testing.B) {
-	if version != 1 {
+	if version.Major != 1 {
 		b.Skipf("Skipping BenchmarkCreate for non version 1 packages because of updated command names")
 	}
 
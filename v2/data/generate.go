@@ -0,0 +1,33 @@
+//go:build ignore
+
+// This program generates the fixture contexts in this directory; run "go generate" in the v2
+// directory after changing it. The README in this directory has the transcript of what anwork
+// prints for the fixtures (see TestFixtures), so it has to be kept up to date with this program.
+package main
+
+import (
+	"time"
+
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
+)
+
+// The fixtures were originally written by anwork in this time zone.
+var est = time.FixedZone("EST", -5*60*60)
+
+func at(hour, minute, second int) time.Time {
+	return time.Date(2018, time.January, 15, hour, minute, second, 0, est)
+}
+
+func main() {
+	anworkcontext.Generate(map[string]*anworkcontext.Builder{
+		// Three tasks: task-a is finished, task-b is blocked, and task-c is running.
+		"default-context": anworkcontext.NewBuilder().
+			Create("task-a", at(18, 59, 47)).
+			Create("task-b", at(18, 59, 50)).
+			Create("task-c", at(18, 59, 52)).
+			SetState("task-a", anworkcontext.Running, at(18, 59, 57)).
+			SetState("task-b", anworkcontext.Blocked, at(19, 0, 2)).
+			SetState("task-a", anworkcontext.Finished, at(19, 0, 7)).
+			SetState("task-c", anworkcontext.Running, at(19, 0, 12)),
+	})
+}
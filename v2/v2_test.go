@@ -1,11 +1,17 @@
 package v2
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ankeesler/anwork_testing/core"
+	anworkcontext "github.com/ankeesler/anwork_testing/core/context"
 )
 
 const (
@@ -16,18 +22,16 @@ const (
 	taskBNote0 = "Note b 0"
 )
 
-var version int
+var version core.Version
+
+//go:generate go run data/generate.go -o data
 
 func TestMain(m *testing.M) {
 	core.RunTests(m, &version)
 }
 
 func getAnwork(t *testing.T) *core.Anwork {
-	anwork, err := core.MakeAnwork(version)
-	if err != nil {
-		t.Fatal("Cannot get anwork:", err)
-	}
-	return anwork
+	return core.MustMakeAnwork(t, version)
 }
 
 func TestCreate(t *testing.T) {
@@ -391,6 +395,87 @@ func TestReset(t *testing.T) {
 	core.Run(t, expects...)
 }
 
+func TestResetPrompt(t *testing.T) {
+	t.Parallel()
+
+	data := []struct {
+		answer string
+		tasks  []string
+	}{
+		{"y", []string{}},
+		{"n", []string{".*" + taskAName + ".*"}},
+	}
+
+	for _, datum := range data {
+		datum := datum
+		t.Run(datum.answer, func(t *testing.T) {
+			t.Parallel()
+
+			anwork := getAnwork(t)
+			defer anwork.Close()
+
+			core.Run(t, core.Expect{anwork, []string{"create", taskAName}, []string{}})
+
+			prompts := []core.Prompt{
+				core.Prompt{Regex: "Are you sure.*\\[y/n\\]", Answer: datum.answer},
+			}
+			result, err := anwork.ExecuteInteractive(context.Background(), prompts, "reset")
+			if err != nil {
+				t.Fatal("Could not answer reset prompt:", err)
+			} else if err := result.Err(); err != nil {
+				t.Fatal("Reset command failed:", err)
+			}
+
+			regexes := []string{"WAITING.*"}
+			regexes = append(regexes, datum.tasks...)
+			regexes = append(regexes, "FINISHED.*")
+			core.Run(t, core.Expect{anwork, []string{"show"}, regexes})
+			if len(datum.tasks) == 0 {
+				expectDoesNotContain(t, anwork, taskAName)
+			}
+		})
+	}
+}
+
+func TestResetInput(t *testing.T) {
+	t.Parallel()
+
+	anwork := getAnwork(t)
+	defer anwork.Close()
+
+	core.Run(t, core.Expect{anwork, []string{"create", taskAName}, []string{}})
+
+	// With no input at all, reset should not delete anything.
+	result, err := anwork.ExecuteInput(context.Background(), strings.NewReader(""), "reset")
+	if err != nil {
+		t.Fatal("Could not run reset command:", err)
+	}
+	if err := result.Err(); err != nil {
+		t.Error("Expected reset to succeed without input:", err)
+	}
+	if !strings.Contains(result.Stdout, "NOT deleting all data") {
+		t.Errorf("Expected reset to refuse to delete anything, got:\n%s", result.Stdout)
+	}
+	core.Run(t, core.Expect{anwork, []string{"show"}, []string{"WAITING.*", ".*" + taskAName + ".*"}})
+
+	// If the prompt never shows up, then we should get an error.
+	prompts := []core.Prompt{core.Prompt{Regex: "this prompt does not exist", Answer: "y"}}
+	if _, err := anwork.ExecuteInteractive(context.Background(), prompts, "version"); err == nil {
+		t.Error("Expected an error when a prompt never appears")
+	} else {
+		t.Logf("Got expected error: %s", err)
+	}
+}
+
+func expectDoesNotContain(t *testing.T, anwork *core.Anwork, taskName string) {
+	output, err := anwork.Run("show")
+	if err != nil {
+		t.Errorf("Command failed: %s", err)
+	} else if strings.Contains(output, taskName) {
+		t.Errorf("Didn't expect to see task name '%s' in output:\n%s", taskName, output)
+	}
+}
+
 func TestSummary(t *testing.T) {
 	t.Parallel()
 
@@ -404,15 +489,73 @@ func TestSummary(t *testing.T) {
 	}
 	core.Run(t, expects...)
 
-	// Wait one second.
-	time.Sleep(time.Second)
+	// Make it look like the tasks were created 2 hours ago.
+	if err := anwork.ElapseTime(2 * time.Hour); err != nil {
+		t.Fatal("Cannot elapse time:", err)
+	}
 
-	// Set one of the tasks as finished. They should be reported in the summary.
+	// Set one of the tasks as finished. It should be reported in the summary. The seconds can be off
+	// by one if the commands happen to run on either side of a second boundary.
 	expects = []core.Expect{
 		core.Expect{anwork, []string{"set-finished", taskAName}, []string{}},
 		core.Expect{anwork,
 			[]string{"summary", "1"},
-			[]string{"\\[.*\\]:.*" + taskAName + ".*", "  took \\ds"}},
+			[]string{"\\[.*\\]:.*" + taskAName + ".*", "  took 2h0m[01]s"}},
+	}
+	core.Run(t, expects...)
+}
+
+func TestSummaryDays(t *testing.T) {
+	t.Parallel()
+
+	anwork := getAnwork(t)
+	defer anwork.Close()
+
+	// Finish task-a 3 days ago, after it took 5 hours, and finish task-b now.
+	expects := []core.Expect{
+		core.Expect{anwork, []string{"create", taskAName}, []string{}},
+	}
+	core.Run(t, expects...)
+	if err := anwork.ElapseTime(5 * time.Hour); err != nil {
+		t.Fatal("Cannot elapse time:", err)
+	}
+	expects = []core.Expect{
+		core.Expect{anwork, []string{"set-finished", taskAName}, []string{}},
+		core.Expect{anwork, []string{"create", taskBName}, []string{}},
+	}
+	core.Run(t, expects...)
+	if err := anwork.ElapseTime(3 * 24 * time.Hour); err != nil {
+		t.Fatal("Cannot elapse time:", err)
+	}
+	expects = []core.Expect{
+		core.Expect{anwork, []string{"set-finished", taskBName}, []string{}},
+	}
+	core.Run(t, expects...)
+
+	// Only the summaries for more than 3 days should have task-a.
+	data := []struct {
+		days  string
+		tasks []string
+	}{
+		{"1", []string{taskBName}},
+		{"2", []string{taskBName}},
+		{"4", []string{taskBName, taskAName}},
+		{"10", []string{taskBName, taskAName}},
+	}
+	for _, d := range data {
+		output, err := anwork.Run("summary", d.days)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := strings.Count(output, "took"); count != len(d.tasks) {
+			t.Errorf("Expected summary %s to have %v, got:\n%s", d.days, d.tasks, output)
+		}
+	}
+
+	expects = []core.Expect{
+		core.Expect{anwork,
+			[]string{"summary", "4"},
+			[]string{".*" + taskBName + ".*", "  took 72h0m[01]s", ".*" + taskAName + ".*", "  took 5h0m[01]s"}},
 	}
 	core.Run(t, expects...)
 }
@@ -454,11 +597,171 @@ func BenchmarkCreate(b *testing.B) {
 
 func BenchmarkCrud(b *testing.B) {
 	b.N = 5
-	core.RunBenchmark(b, version, func(a *core.Anwork, i int) {
+	core.RunCommandBenchmark(b, version, func(i int) [][]string {
 		name := fmt.Sprintf("task-%d", i)
-		a.Run("create", name)
-		a.Run("show")
-		a.Run("set-finished", name)
-		a.Run("delete", name)
+		return [][]string{
+			[]string{"create", name},
+			[]string{"show"},
+			[]string{"set-finished", name},
+			[]string{"delete", name},
+		}
 	})
 }
+
+// Every file in a data directory (other than its README and its generator) is a fixture context,
+// and the README has the transcript of what anwork prints for it.
+func TestFixtures(t *testing.T) {
+	t.Parallel()
+
+	readmes, err := filepath.Glob(filepath.Join("data", "*", "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readmes = append(readmes, filepath.Join("data", "README"))
+
+	for _, readme := range readmes {
+		steps, err := core.ReadTranscript(readme)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			t.Fatal("Cannot read transcript:", err)
+		}
+
+		fixtures, err := filepath.Glob(filepath.Join(filepath.Dir(readme), "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fixture := range fixtures {
+			if info, err := os.Stat(fixture); err != nil || info.IsDir() || fixture == readme ||
+				filepath.Ext(fixture) == ".go" {
+				continue
+			}
+
+			// The dates in the transcripts were printed in this time zone.
+			anwork := core.MustMakeAnwork(t, version, core.WithFixture(fixture),
+				core.WithEnv("TZ=America/New_York"))
+			if err := anwork.CheckTranscript(steps); err != nil {
+				t.Errorf("Fixture %s: %s", fixture, err)
+			}
+		}
+	}
+}
+
+func TestFollowUps(t *testing.T) {
+	t.Parallel()
+
+	// Create task-a and task-b once, and then branch each of the follow-ups off of that state.
+	anwork := getAnwork(t)
+	expects := []core.Expect{
+		core.Expect{anwork, []string{"create", taskAName}, []string{}},
+		core.Expect{anwork, []string{"create", taskBName}, []string{}},
+	}
+	core.Run(t, expects...)
+	snapshot, err := anwork.Snapshot()
+	if err != nil {
+		t.Fatal("Cannot snapshot anwork:", err)
+	}
+
+	data := []struct {
+		name    string
+		command []string
+		show    []string
+	}{
+		{"running", []string{"set-running", taskAName},
+			[]string{"RUNNING.*", ".*" + taskAName + ".*", "BLOCKED.*", "WAITING.*", ".*" + taskBName + ".*",
+				"FINISHED.*"}},
+		{"blocked", []string{"set-blocked", taskBName},
+			[]string{"RUNNING.*", "BLOCKED.*", ".*" + taskBName + ".*", "WAITING.*", ".*" + taskAName + ".*",
+				"FINISHED.*"}},
+		{"finished", []string{"set-finished", taskAName},
+			[]string{"RUNNING.*", "BLOCKED.*", "WAITING.*", ".*" + taskBName + ".*", "FINISHED.*",
+				".*" + taskAName + ".*"}},
+		{"priority", []string{"set-priority", taskBName, "5"},
+			[]string{"RUNNING.*", "BLOCKED.*", "WAITING.*", ".*" + taskBName + ".*", ".*" + taskAName + ".*",
+				"FINISHED.*"}},
+		{"delete", []string{"delete", taskAName},
+			[]string{"RUNNING.*", "BLOCKED.*", "WAITING.*", ".*" + taskBName + ".*", "FINISHED.*"}},
+	}
+	for _, d := range data {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			t.Parallel()
+
+			fork, err := anwork.Fork(snapshot)
+			if err != nil {
+				t.Fatal("Cannot fork anwork:", err)
+			}
+			defer fork.Close()
+
+			expects := []core.Expect{
+				core.Expect{fork, d.command, []string{}},
+				core.Expect{fork, []string{"show"}, d.show},
+			}
+			core.Run(t, expects...)
+		})
+	}
+}
+
+func TestPersistedState(t *testing.T) {
+	t.Parallel()
+
+	anwork := getAnwork(t)
+	expects := []core.Expect{
+		core.Expect{anwork, []string{"create", taskAName}, []string{}},
+		core.Expect{anwork, []string{"create", taskBName}, []string{}},
+		core.Expect{anwork, []string{"set-priority", taskBName, "5"}, []string{}},
+		core.Expect{anwork, []string{"set-blocked", taskAName}, []string{}},
+		core.Expect{anwork, []string{"note", taskBName, taskBNote0}, []string{}},
+		core.Expect{anwork, []string{"delete", taskAName}, []string{}},
+	}
+	core.Run(t, expects...)
+
+	state, err := anwork.State()
+	if err != nil {
+		t.Fatal("Cannot get anwork state:", err)
+	}
+
+	if len(state.Tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d", len(state.Tasks))
+	}
+	task := state.Tasks[0]
+	if task.Name != taskBName || task.ID != 1 || task.Priority != 5 || task.State != anworkcontext.Waiting {
+		t.Errorf("Unexpected task %+v", *task)
+	}
+
+	expectedTypes := []anworkcontext.EntryType{
+		anworkcontext.CreateEntry,
+		anworkcontext.CreateEntry,
+		anworkcontext.SetPriorityEntry,
+		anworkcontext.SetStateEntry,
+		anworkcontext.NoteEntry,
+		anworkcontext.DeleteEntry,
+	}
+	expectedIDs := []int32{0, 1, 1, 0, 1, 0}
+	if len(state.Journal) != len(expectedTypes) {
+		t.Fatalf("Expected %d journal entries, got %d", len(expectedTypes), len(state.Journal))
+	}
+	for i, entry := range state.Journal {
+		if entry.Type != expectedTypes[i] || entry.TaskID != expectedIDs[i] {
+			t.Errorf("Expected journal entry %d to be a %s entry for task %d, got %+v", i, expectedTypes[i],
+				expectedIDs[i], *entry)
+		}
+	}
+	if note := state.Journal[4]; !strings.Contains(note.Title, taskBNote0) {
+		t.Errorf("Expected note entry to contain '%s', got '%s'", taskBNote0, note.Title)
+	}
+}
+
+// The fixture contexts in the data directory should be exactly what data/generate.go writes.
+func TestFixturesAreGenerated(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("Skipping because go is not on the PATH")
+	}
+
+	output, err := exec.Command("go", "run", "data/generate.go", "-o", "data", "-check").CombinedOutput()
+	if err != nil {
+		t.Errorf("Fixtures are not up to date (%s): %s", err, output)
+	}
+}